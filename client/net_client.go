@@ -3,6 +3,7 @@ package client
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/fuyuntt/cchess/ppos"
@@ -19,7 +20,13 @@ func LegalMove(resp http.ResponseWriter, req *http.Request) {
 		logrus.Errorf("create position failure. err=%v", err)
 		return
 	}
-	legal := pos.LegalMove(ppos.GetMoveFromICCS(mv))
+	notation, err := ppos.ParseNotation(query.Get("notation"))
+	if err != nil {
+		logrus.Errorf("parse notation failure. err=%v", err)
+		return
+	}
+	_, err = pos.ParseMove(mv, notation)
+	legal := err == nil
 	marshal, _ := json.Marshal(map[string]interface{}{"isLegal": legal})
 	_, _ = resp.Write(marshal)
 }
@@ -34,16 +41,22 @@ func GetLegalMoves(resp http.ResponseWriter, req *http.Request) {
 		logrus.Errorf("create position failure. err=%v", err)
 		return
 	}
+	notation, err := ppos.ParseNotation(query.Get("notation"))
+	if err != nil {
+		logrus.Errorf("parse notation failure. err=%v", err)
+		return
+	}
 	var legalMoves []string
 	for _, move := range pos.GenerateMoves(false) {
 		if move.ICCS()[:2] != srcSquare {
 			continue
 		}
 		capturedPiece := pos.MovePiece(move)
-		if !pos.Checked() {
-			legalMoves = append(legalMoves, move.ICCS())
-		}
+		legal := !pos.Checked()
 		pos.UndoMovePiece(move, capturedPiece)
+		if legal {
+			legalMoves = append(legalMoves, pos.FormatMove(move, notation))
+		}
 	}
 	marshal, _ := json.Marshal(map[string]interface{}{"legalMoves": legalMoves})
 	_, _ = resp.Write(marshal)
@@ -58,12 +71,87 @@ func Think(resp http.ResponseWriter, req *http.Request) {
 		logrus.Errorf("create position failure. err=%v", err)
 		return
 	}
-	res, score := pos.SearchMain(3 * time.Second)
+	// notation参数指定着法的记法，默认为ICCS
+	notation, err := ppos.ParseNotation(query.Get("notation"))
+	if err != nil {
+		logrus.Errorf("parse notation failure. err=%v", err)
+		return
+	}
+	// multipv参数指定返回的变例数，默认只返回最好的一条
+	multiPV, _ := strconv.Atoi(query.Get("multipv"))
+	if multiPV > ppos.MaxMultiPV {
+		multiPV = ppos.MaxMultiPV
+	}
+	var infos []map[string]interface{}
+	params := ppos.SearchParams{Duration: 3 * time.Second, Contempt: ppos.DefaultContempt, MultiPV: multiPV, OnIteration: func(info ppos.SearchInfo) {
+		infos = append(infos, map[string]interface{}{
+			"depth":   info.Depth,
+			"multipv": info.MultiPV,
+			"score":   info.Score,
+			"bound":   info.Bound,
+			"time":    info.Time.Milliseconds(),
+			"nodes":   info.Nodes,
+			"pv":      pos.FormatMoves(info.PV, notation),
+		})
+	}}
+	// 客户端断开时停止搜索
+	pvLines := pos.SearchMultiPV(req.Context(), params)
 	var moves []string
-	for _, mv := range res {
-		moves = append(moves, mv.ICCS())
+	var score int
+	lines := make([]map[string]interface{}, 0, len(pvLines))
+	for _, line := range pvLines {
+		lines = append(lines, map[string]interface{}{"moves": pos.FormatMoves(line.PV, notation), "score": line.Score})
+	}
+	if len(pvLines) > 0 {
+		moves, score = pos.FormatMoves(pvLines[0].PV, notation), pvLines[0].Score
 	}
 	logrus.Infof("think result, score: %d, moves:%v", score, moves)
-	marshal, _ := json.Marshal(map[string]interface{}{"moves": moves, "score": score})
+	marshal, _ := json.Marshal(map[string]interface{}{"moves": moves, "score": score, "lines": lines, "infos": infos})
 	_, _ = resp.Write(marshal)
 }
+
+// 导出局面中走过的着法，用于生成棋谱
+func ExportMoves(resp http.ResponseWriter, req *http.Request) {
+	resp.WriteHeader(200)
+	query := req.URL.Query()
+	position := query.Get("position")
+	pos, err := ppos.CreatePositionFromPosStr(position)
+	if err != nil {
+		logrus.Errorf("create position failure. err=%v", err)
+		return
+	}
+	notation, err := ppos.ParseNotation(query.Get("notation"))
+	if err != nil {
+		logrus.Errorf("parse notation failure. err=%v", err)
+		return
+	}
+	marshal, _ := json.Marshal(map[string]interface{}{"moves": pos.ExportMoves(notation)})
+	_, _ = resp.Write(marshal)
+}
+
+// 查询局面在开局库中的着法，book为空时总是返回空列表
+func BookMoves(book *ppos.Book) http.HandlerFunc {
+	return func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(200)
+		query := req.URL.Query()
+		position := query.Get("position")
+		pos, err := ppos.CreatePositionFromPosStr(position)
+		if err != nil {
+			logrus.Errorf("create position failure. err=%v", err)
+			return
+		}
+		notation, err := ppos.ParseNotation(query.Get("notation"))
+		if err != nil {
+			logrus.Errorf("parse notation failure. err=%v", err)
+			return
+		}
+		moves := make([]map[string]interface{}, 0)
+		if book != nil {
+			for _, bookMove := range book.Moves(pos) {
+				moves = append(moves, map[string]interface{}{"move": pos.FormatMove(bookMove.Move, notation), "weight": bookMove.Weight})
+			}
+		}
+		marshal, _ := json.Marshal(map[string]interface{}{"moves": moves})
+		_, _ = resp.Write(marshal)
+	}
+}
@@ -0,0 +1,135 @@
+package game
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fuyuntt/cchess/ppos"
+)
+
+// 棋谱的标签，如Event、Red、Black
+type Tag struct {
+	Name  string
+	Value string
+}
+
+// 棋谱中的一步着法
+type MoveNode struct {
+	Move ppos.Move
+	// 走完这一步后的注释
+	Comment string
+	// 替代这一步的变着，从这一步之前的局面开始
+	Variations []*Line
+}
+
+// 一串连续的着法
+type Line struct {
+	// 第一步之前的注释
+	Comment string
+	Moves   []*MoveNode
+}
+
+// 一局棋的棋谱，主线着法和开局注释在内嵌的Line中
+type Game struct {
+	Tags []Tag
+	// 初始局面，空串表示开局局面
+	FEN string
+	Line
+	Result ppos.GameResult
+}
+
+// 从初始局面和主线着法创建棋谱，每步着法都必须合法
+func NewGame(fen string, mvs []ppos.Move) (*Game, error) {
+	g := &Game{FEN: fen}
+	pos, err := g.StartPosition()
+	if err != nil {
+		return nil, err
+	}
+	for _, mv := range mvs {
+		if err := playMove(pos, mv); err != nil {
+			return nil, err
+		}
+		g.Moves = append(g.Moves, &MoveNode{Move: mv})
+	}
+	return g, nil
+}
+
+// 标签的值，没有时返回空串
+func (g *Game) Tag(name string) string {
+	for _, tag := range g.Tags {
+		if tag.Name == name {
+			return tag.Value
+		}
+	}
+	return ""
+}
+
+// 设置标签，已有的标签保持原来的顺序
+func (g *Game) SetTag(name, value string) {
+	for i, tag := range g.Tags {
+		if tag.Name == name {
+			g.Tags[i].Value = value
+			return
+		}
+	}
+	g.Tags = append(g.Tags, Tag{name, value})
+}
+
+// 初始局面
+func (g *Game) StartPosition() (*ppos.Position, error) {
+	if g.FEN == "" {
+		return ppos.CreatePositionFromPosStr("startpos")
+	}
+	return ppos.ParseFEN(g.FEN)
+}
+
+// 主线着法
+func (g *Game) MainLine() []ppos.Move {
+	mvs := make([]ppos.Move, 0, len(g.Moves))
+	for _, node := range g.Moves {
+		mvs = append(mvs, node.Move)
+	}
+	return mvs
+}
+
+// 走完主线后的局面
+func (g *Game) Position() (*ppos.Position, error) {
+	pos, err := g.StartPosition()
+	if err != nil {
+		return nil, err
+	}
+	for _, mv := range g.MainLine() {
+		if err := playMove(pos, mv); err != nil {
+			return nil, err
+		}
+	}
+	return pos, nil
+}
+
+// 主线对应的UCCI position参数，用于在引擎中重放
+func (g *Game) PositionString() string {
+	var sb strings.Builder
+	if g.FEN == "" {
+		sb.WriteString("startpos")
+	} else {
+		sb.WriteString("fen ")
+		sb.WriteString(g.FEN)
+	}
+	if len(g.Moves) > 0 {
+		sb.WriteString(" moves")
+		for _, mv := range g.MainLine() {
+			sb.WriteString(" ")
+			sb.WriteString(mv.ICCS())
+		}
+	}
+	return sb.String()
+}
+
+// 检查着法合法后走棋
+func playMove(pos *ppos.Position, mv ppos.Move) error {
+	if !pos.LegalMove(mv) {
+		return fmt.Errorf("illegal move %s at %s", mv.ICCS(), pos.FenString())
+	}
+	pos.MakeMove(mv)
+	return nil
+}
@@ -0,0 +1,464 @@
+package game
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/fuyuntt/cchess/ppos"
+)
+
+// Format标签的值与着法记法的对应
+var pgnFormats = []struct {
+	name     string
+	notation ppos.Notation
+}{
+	{"ICCS", ppos.NotationICCS},
+	{"WXF", ppos.NotationWXF},
+	{"Chinese", ppos.NotationChinese},
+}
+
+func formatName(notation ppos.Notation) string {
+	for _, format := range pgnFormats {
+		if format.notation == notation {
+			return format.name
+		}
+	}
+	return "ICCS"
+}
+
+type pgnTokenKind int8
+
+const (
+	tokTag pgnTokenKind = iota
+	tokComment
+	tokOpen
+	tokClose
+	tokWord
+)
+
+type pgnToken struct {
+	kind pgnTokenKind
+	// 标签名、注释或单词
+	text string
+	// 标签的值
+	value string
+	line  int
+}
+
+// 拆分PGN文本，花括号和分号开始的是注释，方括号是标签，圆括号是变着
+func tokenizePGN(text string) ([]pgnToken, error) {
+	var tokens []pgnToken
+	runes := []rune(text)
+	line := 1
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\n':
+			line++
+		case unicode.IsSpace(r):
+		case r == '{':
+			end := indexRune(runes, i+1, '}')
+			if end < 0 {
+				return nil, fmt.Errorf("pgn line %d: unterminated comment", line)
+			}
+			comment := string(runes[i+1 : end])
+			tokens = append(tokens, pgnToken{kind: tokComment, text: strings.TrimSpace(comment), line: line})
+			line += strings.Count(comment, "\n")
+			i = end
+		case r == ';':
+			end := indexRune(runes, i+1, '\n')
+			if end < 0 {
+				end = len(runes)
+			}
+			tokens = append(tokens, pgnToken{kind: tokComment, text: strings.TrimSpace(string(runes[i+1 : end])), line: line})
+			i = end - 1
+		case r == '[':
+			tag, end, err := parseTag(runes, i+1)
+			if err != nil {
+				return nil, fmt.Errorf("pgn line %d: %v", line, err)
+			}
+			tag.line = line
+			tokens = append(tokens, tag)
+			i = end
+		case r == '(':
+			tokens = append(tokens, pgnToken{kind: tokOpen, line: line})
+		case r == ')':
+			tokens = append(tokens, pgnToken{kind: tokClose, line: line})
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && !strings.ContainsRune("{};[]()", runes[end]) {
+				end++
+			}
+			tokens = append(tokens, pgnToken{kind: tokWord, text: string(runes[i:end]), line: line})
+			i = end - 1
+		}
+	}
+	return tokens, nil
+}
+
+func indexRune(runes []rune, start int, r rune) int {
+	for i := start; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// 解析[Name "Value"]，返回标签和右方括号的位置
+func parseTag(runes []rune, start int) (pgnToken, int, error) {
+	i := start
+	for i < len(runes) && runes[i] != '"' && runes[i] != ']' {
+		i++
+	}
+	name := strings.TrimSpace(string(runes[start:i]))
+	if i >= len(runes) || runes[i] != '"' || name == "" {
+		return pgnToken{}, 0, fmt.Errorf("illegal tag")
+	}
+	var value strings.Builder
+	for i++; i < len(runes) && runes[i] != '"'; i++ {
+		if runes[i] == '\\' && i+1 < len(runes) {
+			i++
+		}
+		value.WriteRune(runes[i])
+	}
+	end := indexRune(runes, i+1, ']')
+	if i >= len(runes) || end < 0 {
+		return pgnToken{}, 0, fmt.Errorf("unterminated tag %s", name)
+	}
+	return pgnToken{kind: tokTag, text: name, value: value.String()}, end, nil
+}
+
+// 读取PGN文件中的全部棋谱
+func ReadPGN(r io.Reader) ([]*Game, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePGN(string(data))
+}
+
+// 解析PGN文本中的全部棋谱，着法按Format标签的记法解析，没有Format标签时自动识别
+func ParsePGN(text string) ([]*Game, error) {
+	tokens, err := tokenizePGN(strings.TrimPrefix(text, "\ufeff"))
+	if err != nil {
+		return nil, err
+	}
+	p := &pgnParser{tokens: tokens}
+	var games []*Game
+	for p.idx < len(p.tokens) {
+		g, err := p.parseGame()
+		if err != nil {
+			return nil, err
+		}
+		games = append(games, g)
+	}
+	return games, nil
+}
+
+type pgnParser struct {
+	tokens []pgnToken
+	idx    int
+	// 没有Format标签时自动识别记法
+	notation   ppos.Notation
+	autoDetect bool
+}
+
+func (p *pgnParser) parseGame() (*Game, error) {
+	g := &Game{}
+	p.notation, p.autoDetect = ppos.NotationICCS, true
+	for ; p.idx < len(p.tokens) && p.tokens[p.idx].kind == tokTag; p.idx++ {
+		tag := p.tokens[p.idx]
+		switch tag.text {
+		case "FEN":
+			g.FEN = tag.value
+		case "Result":
+			g.Result = parseResult(tag.value)
+		case "Format":
+			notation, ok := parseFormat(tag.value)
+			if !ok {
+				return nil, fmt.Errorf("pgn line %d: unknown format %s", tag.line, tag.value)
+			}
+			p.notation, p.autoDetect = notation, false
+		default:
+			g.SetTag(tag.text, tag.value)
+		}
+	}
+	pos, err := g.StartPosition()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.parseLine(pos, &g.Line, g, false); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+var (
+	moveNumberRegexp = regexp.MustCompile(`^\d+\.+`)
+	// 着法后的评注符号和数字评注
+	annotationRegexp = regexp.MustCompile(`^(?:[!?]+|\$\d+)$`)
+)
+
+// 解析一串着法直到棋谱结束或变着结束，变着结束时把局面退回到变着开始前
+func (p *pgnParser) parseLine(pos *ppos.Position, line *Line, g *Game, nested bool) error {
+	for ; p.idx < len(p.tokens); p.idx++ {
+		tok := p.tokens[p.idx]
+		var last *MoveNode
+		if len(line.Moves) > 0 {
+			last = line.Moves[len(line.Moves)-1]
+		}
+		switch tok.kind {
+		case tokTag:
+			if nested {
+				return fmt.Errorf("pgn line %d: unterminated variation", tok.line)
+			}
+			return nil
+		case tokComment:
+			if last == nil {
+				line.Comment = joinComment(line.Comment, tok.text)
+			} else {
+				last.Comment = joinComment(last.Comment, tok.text)
+			}
+		case tokOpen:
+			if last == nil {
+				return fmt.Errorf("pgn line %d: variation before any move", tok.line)
+			}
+			pos.UndoMakeMove()
+			variation := &Line{}
+			p.idx++
+			if err := p.parseLine(pos, variation, g, true); err != nil {
+				return err
+			}
+			pos.MakeMove(last.Move)
+			last.Variations = append(last.Variations, variation)
+		case tokClose:
+			if !nested {
+				return fmt.Errorf("pgn line %d: unexpected ')'", tok.line)
+			}
+			for range line.Moves {
+				pos.UndoMakeMove()
+			}
+			return nil
+		case tokWord:
+			if result, ok := resultToken(tok.text); ok {
+				// 变着中的结果只是说明，不影响整局的结果
+				if !nested {
+					g.Result = result
+					p.idx++
+					return nil
+				}
+				continue
+			}
+			word := tok.text
+			if annotationRegexp.MatchString(word) || moveNumberRegexp.FindString(word) == word {
+				continue
+			}
+			mv, err := p.parseMove(pos, word)
+			if err != nil {
+				// 回合数和着法连在一起，如1.H2-E2
+				if prefix := moveNumberRegexp.FindString(word); prefix != "" {
+					mv, err = p.parseMove(pos, word[len(prefix):])
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("pgn line %d: %v", tok.line, err)
+			}
+			if err := playMove(pos, mv); err != nil {
+				return fmt.Errorf("pgn line %d: %v", tok.line, err)
+			}
+			line.Moves = append(line.Moves, &MoveNode{Move: mv})
+		}
+	}
+	if nested {
+		return fmt.Errorf("pgn: unterminated variation")
+	}
+	return nil
+}
+
+// 按棋谱的记法解析着法，ICCS着法可以写成H2-E2
+func (p *pgnParser) parseMove(pos *ppos.Position, word string) (ppos.Move, error) {
+	word = strings.TrimRight(word, "!?+#")
+	if p.autoDetect {
+		for _, format := range pgnFormats {
+			if mv, err := parseNotationMove(pos, word, format.notation); err == nil {
+				return mv, nil
+			}
+		}
+		return ppos.MvNop, fmt.Errorf("illegal move: %s", word)
+	}
+	return parseNotationMove(pos, word, p.notation)
+}
+
+func parseNotationMove(pos *ppos.Position, word string, notation ppos.Notation) (ppos.Move, error) {
+	if notation == ppos.NotationICCS {
+		word = strings.ToLower(strings.Replace(word, "-", "", 1))
+	}
+	return pos.ParseMove(word, notation)
+}
+
+func joinComment(comment, text string) string {
+	if comment == "" {
+		return text
+	}
+	return comment + "\n" + text
+}
+
+func parseFormat(name string) (ppos.Notation, bool) {
+	for _, format := range pgnFormats {
+		if strings.EqualFold(format.name, name) {
+			return format.notation, true
+		}
+	}
+	return ppos.NotationICCS, false
+}
+
+func resultToken(word string) (ppos.GameResult, bool) {
+	for _, result := range []ppos.GameResult{ppos.ResultRedWin, ppos.ResultBlackWin, ppos.ResultDraw, ppos.ResultUnfinished} {
+		if word == result.String() {
+			return result, true
+		}
+	}
+	return ppos.ResultUnfinished, false
+}
+
+func parseResult(value string) ppos.GameResult {
+	result, _ := resultToken(value)
+	return result
+}
+
+// PGN每行的最大长度
+const pgnLineWidth = 80
+
+// 用指定记法写出PGN，Format标签由记法决定
+func (g *Game) WritePGN(w io.Writer, notation ppos.Notation) error {
+	pos, err := g.StartPosition()
+	if err != nil {
+		return err
+	}
+	var sb strings.Builder
+	for _, tag := range g.Tags {
+		switch tag.Name {
+		case "FEN", "Result", "Format":
+			continue
+		}
+		writeTag(&sb, tag.Name, tag.Value)
+	}
+	writeTag(&sb, "Result", g.Result.String())
+	if g.FEN != "" {
+		writeTag(&sb, "FEN", g.FEN)
+	}
+	writeTag(&sb, "Format", formatName(notation))
+	sb.WriteString("\n")
+	mw := &moveTextWriter{sb: &sb, notation: notation}
+	if err := mw.writeLine(pos, &g.Line); err != nil {
+		return err
+	}
+	mw.word(g.Result.String())
+	sb.WriteString("\n\n")
+	_, err = io.WriteString(w, sb.String())
+	return err
+}
+
+// 用指定记法生成PGN文本
+func (g *Game) PGN(notation ppos.Notation) (string, error) {
+	var sb strings.Builder
+	if err := g.WritePGN(&sb, notation); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+func writeTag(sb *strings.Builder, name, value string) {
+	value = strings.Replace(strings.Replace(value, `\`, `\\`, -1), `"`, `\"`, -1)
+	_, _ = fmt.Fprintf(sb, "[%s \"%s\"]\n", name, value)
+}
+
+// 写着法部分，超过行宽时换行
+type moveTextWriter struct {
+	sb       *strings.Builder
+	notation ppos.Notation
+	col      int
+	// 左括号后不需要空格
+	glue bool
+}
+
+func (mw *moveTextWriter) word(word string) {
+	width := utf8.RuneCountInString(word)
+	switch {
+	case mw.col == 0 || mw.glue:
+	case mw.col+1+width > pgnLineWidth:
+		mw.sb.WriteString("\n")
+		mw.col = 0
+	default:
+		mw.sb.WriteString(" ")
+		mw.col++
+	}
+	mw.sb.WriteString(word)
+	mw.col += width
+	mw.glue = false
+}
+
+func (mw *moveTextWriter) comment(comment string) {
+	if comment != "" {
+		mw.word("{" + strings.Replace(comment, "}", ")", -1) + "}")
+	}
+}
+
+// 写出一串着法及其变着，写完后局面不变
+func (mw *moveTextWriter) writeLine(pos *ppos.Position, line *Line) error {
+	mw.comment(line.Comment)
+	// 黑方着法在开头、注释和变着之后要写出回合数
+	needNumber := true
+	played := 0
+	defer func() {
+		for ; played > 0; played-- {
+			pos.UndoMakeMove()
+		}
+	}()
+	for _, node := range line.Moves {
+		if !pos.LegalMove(node.Move) {
+			return fmt.Errorf("illegal move %s at %s", node.Move.ICCS(), pos.FenString())
+		}
+		// 回合数和着法不分开换行
+		word := mw.format(pos, node.Move)
+		if pos.PlayerSide() == ppos.SdRed {
+			word = fmt.Sprintf("%d. %s", pos.FullMove(), word)
+		} else if needNumber {
+			word = fmt.Sprintf("%d... %s", pos.FullMove(), word)
+		}
+		needNumber = false
+		mw.word(word)
+		if node.Comment != "" {
+			mw.comment(node.Comment)
+			needNumber = true
+		}
+		for _, variation := range node.Variations {
+			mw.word("(")
+			mw.glue = true
+			if err := mw.writeLine(pos, variation); err != nil {
+				return err
+			}
+			mw.sb.WriteString(")")
+			mw.col++
+			needNumber = true
+		}
+		pos.MakeMove(node.Move)
+		played++
+	}
+	return nil
+}
+
+// PGN中的ICCS着法写成H2-E2
+func (mw *moveTextWriter) format(pos *ppos.Position, mv ppos.Move) string {
+	if mw.notation == ppos.NotationICCS {
+		iccs := strings.ToUpper(mv.ICCS())
+		return iccs[:2] + "-" + iccs[2:]
+	}
+	return pos.FormatMove(mv, mw.notation)
+}
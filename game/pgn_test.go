@@ -0,0 +1,162 @@
+package game
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fuyuntt/cchess/ppos"
+)
+
+const iccsPGN = `[Game "Chinese Chess"]
+[Event "测试赛"]
+[Red "红方"]
+[Black "黑方"]
+[Result "1-0"]
+[Format "ICCS"]
+
+{中炮对屏风马}
+1. H2-E2 H9-G7 {屏风马} (1... H7-E7 2. H0-G2) 2. H0-G2 I9-H9
+3. I0-H0 ; 出车
+B9-C7 1-0
+`
+
+func TestParsePGN(t *testing.T) {
+	games, err := ParsePGN(iccsPGN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(games) != 1 {
+		t.Fatalf("expect 1 game, got %d", len(games))
+	}
+	g := games[0]
+	if g.Tag("Event") != "测试赛" || g.Tag("Red") != "红方" || g.Tag("Format") != "" || g.Result != ppos.ResultRedWin {
+		t.Errorf("unexpected tags %v, result %v", g.Tags, g.Result)
+	}
+	if moves := iccsList(g.MainLine()); moves != "h2e2 h9g7 h0g2 i9h9 i0h0 b9c7" {
+		t.Errorf("unexpected main line: %s", moves)
+	}
+	if g.Comment != "中炮对屏风马" || g.Moves[1].Comment != "屏风马" || g.Moves[4].Comment != "出车" {
+		t.Errorf("unexpected comments: %q %q %q", g.Comment, g.Moves[1].Comment, g.Moves[4].Comment)
+	}
+	if len(g.Moves[1].Variations) != 1 || len(g.Moves[1].Variations[0].Moves) != 2 || g.Moves[1].Variations[0].Moves[0].Move.ICCS() != "h7e7" {
+		t.Errorf("unexpected variation")
+	}
+	if g.PositionString() != "startpos moves h2e2 h9g7 h0g2 i9h9 i0h0 b9c7" {
+		t.Errorf("unexpected position string: %s", g.PositionString())
+	}
+}
+
+func TestParsePGNNotations(t *testing.T) {
+	tests := []string{
+		"[Format \"WXF\"]\n1. C2.5 H8+7 2. H2+3 R9.8 *",
+		"[Format \"Chinese\"]\n1. 炮二平五 马８进７ 2. 马二进三 车９平８ *",
+		// 没有Format标签时自动识别，回合数可以和着法连在一起
+		"1.h2e2 h9g7 2.炮 二平五",
+		"1.炮二平五 马8进7 2.H2+3 I9-H9",
+	}
+	expect := []string{
+		"h2e2 h9g7 h0g2 i9h9",
+		"h2e2 h9g7 h0g2 i9h9",
+		"",
+		"h2e2 h9g7 h0g2 i9h9",
+	}
+	for i, text := range tests {
+		games, err := ParsePGN(text)
+		if expect[i] == "" {
+			if err == nil {
+				t.Errorf("%s: expect error", text)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", text, err)
+			continue
+		}
+		if moves := iccsList(games[0].MainLine()); moves != expect[i] {
+			t.Errorf("%s: expect %s, got %s", text, expect[i], moves)
+		}
+	}
+}
+
+func TestParsePGNErrors(t *testing.T) {
+	for _, text := range []string{
+		// 非法着法
+		"1. H2-E3",
+		// 变着没有结束
+		"1. H2-E2 (1. H0-G2",
+		"1. H2-E2 )",
+		"[Format \"XYZ\"]\n1. H2-E2",
+		"[FEN \"rnbakabnr/9/1c5c1/p1p1p1p1p/9 w\"]",
+		"{没有结束的注释",
+	} {
+		if _, err := ParsePGN(text); err == nil {
+			t.Errorf("%s: expect error", text)
+		}
+	}
+}
+
+func TestWritePGN(t *testing.T) {
+	games, err := ParsePGN(iccsPGN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := games[0].PGN(ppos.NotationChinese)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `[Game "Chinese Chess"]
+[Event "测试赛"]
+[Red "红方"]
+[Black "黑方"]
+[Result "1-0"]
+[Format "Chinese"]
+
+{中炮对屏风马} 1. 炮二平五 马８进７ {屏风马} (1... 炮８平５ 2. 马二进三) 2. 马二进三 车９平８ 3. 车一平二 {出车}
+3... 马２进３ 1-0
+
+`
+	if text != expect {
+		t.Errorf("expect:\n%s\ngot:\n%s", expect, text)
+	}
+	// 每种记法写出后都能读回同样的棋谱
+	for _, notation := range []ppos.Notation{ppos.NotationICCS, ppos.NotationWXF, ppos.NotationChinese} {
+		text, err := games[0].PGN(notation)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := ParsePGN(text)
+		if err != nil {
+			t.Fatalf("%v: %v\n%s", notation, err, text)
+		}
+		if !reflect.DeepEqual(parsed[0], games[0]) {
+			t.Errorf("%v: game changed after round trip:\n%s", notation, text)
+		}
+	}
+}
+
+func TestWritePGNFromFEN(t *testing.T) {
+	fen := "4k4/9/9/9/9/9/9/9/4R4/5K3 b - - 0 10"
+	g, err := NewGame(fen, []ppos.Move{ppos.GetMoveFromICCS("e9d9"), ppos.GetMoveFromICCS("e1d1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := g.PGN(ppos.NotationWXF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text, "[FEN \""+fen+"\"]") || !strings.Contains(text, "10... K5.4 11. R5.6 *") {
+		t.Errorf("unexpected pgn:\n%s", text)
+	}
+	if _, err := NewGame(fen, []ppos.Move{ppos.GetMoveFromICCS("e9e8"), ppos.GetMoveFromICCS("e1e2")}); err == nil {
+		t.Errorf("expect illegal move error")
+	}
+}
+
+func iccsList(mvs []ppos.Move) string {
+	moves := make([]string, 0, len(mvs))
+	for _, mv := range mvs {
+		moves = append(moves, mv.ICCS())
+	}
+	return strings.Join(moves, " ")
+}
@@ -0,0 +1,318 @@
+package game
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/fuyuntt/cchess/ppos"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// XQF(象棋演播室)文件头的长度，着法记录从文件头之后开始
+const xqfHeaderSize = 1024
+
+// 支持的最高版本
+const xqfMaxVersion = 18
+
+// 密钥流掩码
+const xqfStreamMask = "[(C) Copyright Mr. Dong Shiwei.]"
+
+// 文件头中32个棋子的顺序，前16个为红方，后16个为黑方
+var xqfPieceTypes = [16]ppos.PieceType{
+	ppos.PtRook, ppos.PtKnight, ppos.PtBishop, ppos.PtAdvisor, ppos.PtKing, ppos.PtAdvisor, ppos.PtBishop, ppos.PtKnight,
+	ppos.PtRook, ppos.PtCannon, ppos.PtCannon, ppos.PtPawn, ppos.PtPawn, ppos.PtPawn, ppos.PtPawn, ppos.PtPawn,
+}
+
+// 文件头中的字符串字段，第一个字节是长度，后面是GBK编码的内容
+var xqfTags = []struct {
+	name   string
+	offset int
+	size   int
+}{
+	{"Title", 0x50, 64},
+	{"Event", 0xd0, 64},
+	{"Date", 0x110, 16},
+	{"Site", 0x120, 16},
+	{"Red", 0x130, 16},
+	{"Black", 0x140, 16},
+	{"Opening", 0x150, 64},
+}
+
+const (
+	// 结果在文件头中的位置，1红胜 2黑胜 3和棋
+	xqfResultOffset = 0x33
+	// 有后续着法
+	xqfTagNext = 0x80
+	// 有变着
+	xqfTagAlt = 0x40
+	// 有注释，1.1版以后才有
+	xqfTagComment = 0x20
+)
+
+// 读取XQF棋谱
+func ReadXQF(r io.Reader) (*Game, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return ParseXQF(data)
+}
+
+// 解析XQF棋谱，1.1版以后的文件是加密的
+func ParseXQF(data []byte) (*Game, error) {
+	if len(data) < xqfHeaderSize || data[0] != 'X' || data[1] != 'Q' {
+		return nil, fmt.Errorf("xqf: not a xqf file")
+	}
+	d := &xqfDecoder{data: data, off: xqfHeaderSize, version: data[2]}
+	if d.version > xqfMaxVersion {
+		return nil, fmt.Errorf("xqf: unsupported version %d", d.version)
+	}
+	d.initKeys()
+	g := &Game{Result: xqfResult(data[xqfResultOffset])}
+	for _, tag := range xqfTags {
+		if value := d.headerString(tag.offset, tag.size); value != "" {
+			g.SetTag(tag.name, value)
+		}
+	}
+	root, err := d.readNode()
+	if err != nil {
+		return nil, err
+	}
+	g.Comment = root.comment
+	pos, err := d.startPosition(root.next)
+	if err != nil {
+		return nil, err
+	}
+	if start, _ := ppos.CreatePositionFromPosStr("startpos"); pos.FenString() != start.FenString() {
+		g.FEN = pos.FenString()
+	}
+	line, err := xqfLine(pos, root.next, false)
+	if err != nil {
+		return nil, err
+	}
+	g.Moves = line.Moves
+	return g, nil
+}
+
+// XQF中的一个着法记录，next是后续着法，alt是这一步的下一个变着
+type xqfNode struct {
+	src, dst byte
+	comment  string
+	next     *xqfNode
+	alt      *xqfNode
+}
+
+type xqfDecoder struct {
+	data    []byte
+	off     int
+	version byte
+	// 棋子位置、着法起点、着法终点和注释长度的偏移值
+	pieceOff, srcOff, dstOff byte
+	commentOff               int
+	stream                   [32]byte
+}
+
+// 由文件头中的密钥计算各项偏移值和密钥流，1.0版及以前没有加密
+func (d *xqfDecoder) initKeys() {
+	if d.version <= 10 {
+		return
+	}
+	head := d.data
+	square54Plus221 := func(x byte) byte {
+		return byte(int(x)*int(x)*54 + 221)
+	}
+	d.pieceOff = square54Plus221(head[13]) * head[13]
+	d.srcOff = square54Plus221(head[14]) * d.pieceOff
+	d.dstOff = square54Plus221(head[15]) * d.srcOff
+	d.commentOff = (int(head[12])*256+int(head[13]))%32000 + 767
+	for i := range d.stream {
+		key := head[8+i%4] | (head[12+i%4] & head[3])
+		d.stream[i] = key & xqfStreamMask[i]
+	}
+}
+
+func xqfResult(b byte) ppos.GameResult {
+	switch b {
+	case 1:
+		return ppos.ResultRedWin
+	case 2:
+		return ppos.ResultBlackWin
+	case 3:
+		return ppos.ResultDraw
+	default:
+		return ppos.ResultUnfinished
+	}
+}
+
+func (d *xqfDecoder) headerString(offset, size int) string {
+	n := int(d.data[offset])
+	if n >= size {
+		n = size - 1
+	}
+	return decodeGBK(d.data[offset+1 : offset+1+n])
+}
+
+func decodeGBK(b []byte) string {
+	b = bytes.TrimRight(b, "\x00")
+	text, err := simplifiedchinese.GBK.NewDecoder().Bytes(b)
+	if err != nil {
+		return string(b)
+	}
+	return string(text)
+}
+
+// 读取并解密n个字节，密钥流按文件中的位置循环使用
+func (d *xqfDecoder) read(n int) ([]byte, error) {
+	if n < 0 || d.off+n > len(d.data) {
+		return nil, fmt.Errorf("xqf: unexpected end of file at %d", d.off)
+	}
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = d.data[d.off+i] - d.stream[(d.off+i)%32]
+	}
+	d.off += n
+	return b, nil
+}
+
+func (d *xqfDecoder) readInt32() (int, error) {
+	b, err := d.read(4)
+	if err != nil {
+		return 0, err
+	}
+	return int(int32(binary.LittleEndian.Uint32(b))), nil
+}
+
+// 按先序读取一个着法记录以及它的后续着法和变着
+func (d *xqfDecoder) readNode() (*xqfNode, error) {
+	b, err := d.read(4)
+	if err != nil {
+		return nil, err
+	}
+	node := &xqfNode{src: b[0] - 24 - d.srcOff, dst: b[1] - 32 - d.dstOff}
+	var tag byte
+	commentLen := 0
+	if d.version <= 10 {
+		// 老版本的每个记录都有注释长度
+		if b[2]&0xf0 != 0 {
+			tag |= xqfTagNext
+		}
+		if b[2]&0x0f != 0 {
+			tag |= xqfTagAlt
+		}
+		if commentLen, err = d.readInt32(); err != nil {
+			return nil, err
+		}
+	} else {
+		tag = b[2] & 0xe0
+		if tag&xqfTagComment != 0 {
+			if commentLen, err = d.readInt32(); err != nil {
+				return nil, err
+			}
+			commentLen -= d.commentOff
+		}
+	}
+	if commentLen > 0 {
+		comment, err := d.read(commentLen)
+		if err != nil {
+			return nil, err
+		}
+		node.comment = decodeGBK(comment)
+	} else if commentLen < 0 {
+		return nil, fmt.Errorf("xqf: illegal comment length %d at %d", commentLen, d.off)
+	}
+	if tag&xqfTagNext != 0 {
+		if node.next, err = d.readNode(); err != nil {
+			return nil, err
+		}
+	}
+	if tag&xqfTagAlt != 0 {
+		if node.alt, err = d.readNode(); err != nil {
+			return nil, err
+		}
+	}
+	return node, nil
+}
+
+// XQF的格子是x*10+y，y从红方底线数起，90以上表示棋子不在棋盘上
+func xqfSquare(b byte) (ppos.Square, bool) {
+	if b >= 90 {
+		return 0, false
+	}
+	return ppos.GetSquare(int(b/10), 9-int(b%10)), true
+}
+
+// 由文件头中的棋子位置摆出初始局面，XQF不记录走棋方，由第一步着法的棋子决定
+func (d *xqfDecoder) startPosition(first *xqfNode) (*ppos.Position, error) {
+	var squares [32]byte
+	for i := range squares {
+		b := d.data[0x10+i] - d.pieceOff
+		// 1.2版以后棋子位置也被打乱了
+		if d.version >= 12 {
+			squares[(int(d.pieceOff)+1+i)%32] = b
+		} else {
+			squares[i] = b
+		}
+	}
+	pos := ppos.CreatePosition()
+	for i, b := range squares {
+		sq, ok := xqfSquare(b)
+		if !ok {
+			continue
+		}
+		side := ppos.SdRed
+		if i >= 16 {
+			side = ppos.SdBlack
+		}
+		pos.AddPiece(sq, ppos.GetPiece(xqfPieceTypes[i%16], side))
+	}
+	if first != nil {
+		if sq, ok := xqfSquare(first.src); ok && pos.PieceAt(sq).GetSide() == ppos.SdBlack {
+			pos.ChangeSide()
+		}
+	}
+	return ppos.ParseFEN(pos.FenString())
+}
+
+// 从n开始的一串着法，skipAlt为true时n的兄弟节点已经作为变着处理过
+func xqfLine(pos *ppos.Position, n *xqfNode, skipAlt bool) (*Line, error) {
+	line := &Line{}
+	defer func() {
+		for range line.Moves {
+			pos.UndoMakeMove()
+		}
+	}()
+	for ; n != nil; n = n.next {
+		mv, err := xqfMove(n)
+		if err != nil {
+			return nil, err
+		}
+		node := &MoveNode{Move: mv, Comment: n.comment}
+		if !skipAlt {
+			for alt := n.alt; alt != nil; alt = alt.alt {
+				variation, err := xqfLine(pos, alt, true)
+				if err != nil {
+					return nil, err
+				}
+				node.Variations = append(node.Variations, variation)
+			}
+		}
+		skipAlt = false
+		if err := playMove(pos, mv); err != nil {
+			return nil, fmt.Errorf("xqf: %v", err)
+		}
+		line.Moves = append(line.Moves, node)
+	}
+	return line, nil
+}
+
+func xqfMove(n *xqfNode) (ppos.Move, error) {
+	src, ok1 := xqfSquare(n.src)
+	dst, ok2 := xqfSquare(n.dst)
+	if !ok1 || !ok2 {
+		return ppos.MvNop, fmt.Errorf("xqf: illegal move %d-%d", n.src, n.dst)
+	}
+	return ppos.GetMove(src, dst), nil
+}
@@ -0,0 +1,96 @@
+package game
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/fuyuntt/cchess/ppos"
+)
+
+func readXQFFile(t *testing.T, name string) *Game {
+	file, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	g, err := ReadXQF(file)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return g
+}
+
+func TestReadXQF(t *testing.T) {
+	// 同一局棋分别用不加密的1.0版和加密的1.1版、1.8版保存
+	// 这些文件是按格式说明生成的，还没有象棋演播室保存的真实文件
+	plain := readXQFFile(t, "plain.xqf")
+	for _, name := range []string{"encrypted.xqf", "encrypted11.xqf"} {
+		if g := readXQFFile(t, name); !reflect.DeepEqual(g, plain) {
+			t.Errorf("%s: decoded game differs from plain.xqf", name)
+		}
+	}
+	if plain.Tag("Event") != "全国象棋个人赛" || plain.Tag("Red") != "红方棋手" || plain.Tag("Black") != "黑方棋手" ||
+		plain.Tag("Date") != "2020.10.01" || plain.Tag("Opening") != "中炮" || plain.Result != ppos.ResultRedWin {
+		t.Errorf("unexpected tags %v, result %v", plain.Tags, plain.Result)
+	}
+	if plain.FEN != "" || plain.Comment != "中炮对屏风马" {
+		t.Errorf("unexpected fen %q, comment %q", plain.FEN, plain.Comment)
+	}
+	if moves := iccsList(plain.MainLine()); moves != "h2e2 h9g7 h0g2 i9h9 i0h0 b9c7" {
+		t.Errorf("unexpected main line: %s", moves)
+	}
+	if plain.Moves[0].Comment != "中炮" || plain.Moves[1].Comment != "屏风马" || plain.Moves[4].Comment != "出车" {
+		t.Errorf("unexpected comments")
+	}
+	variations := plain.Moves[1].Variations
+	if len(variations) != 2 || iccsList(lineMoves(variations[0])) != "h7e7 h0g2" || variations[0].Moves[0].Comment != "列炮" ||
+		iccsList(lineMoves(variations[1])) != "b9c7" {
+		t.Errorf("unexpected variations")
+	}
+	if _, err := plain.PGN(ppos.NotationChinese); err != nil {
+		t.Errorf("export xqf game to pgn: %v", err)
+	}
+}
+
+func TestReadXQFEndgame(t *testing.T) {
+	g := readXQFFile(t, "endgame.xqf")
+	// 第一步是黑方走的
+	if g.FEN != "5k3/4a4/9/9/9/9/2p6/9/4R4/3K5 b - - 0 1" {
+		t.Errorf("unexpected fen: %s", g.FEN)
+	}
+	if moves := iccsList(g.MainLine()); moves != "e8d7 e1e8" || g.Moves[0].Comment != "撑士" {
+		t.Errorf("unexpected main line: %s", moves)
+	}
+	if len(g.Moves[0].Variations) != 1 || iccsList(lineMoves(g.Moves[0].Variations[0])) != "f9f8 e1f1" {
+		t.Errorf("unexpected variations")
+	}
+}
+
+func TestReadXQFErrors(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/encrypted.xqf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsupported := append([]byte{}, data...)
+	unsupported[2] = 19
+	for name, bad := range map[string][]byte{
+		"truncated":   data[:len(data)-3],
+		"header only": data[:xqfHeaderSize-1],
+		"not xqf":     append([]byte("XP"), data[2:]...),
+		"unsupported": unsupported,
+	} {
+		if _, err := ParseXQF(bad); err == nil {
+			t.Errorf("%s: expect error", name)
+		}
+	}
+}
+
+func lineMoves(line *Line) []ppos.Move {
+	mvs := make([]ppos.Move, 0, len(line.Moves))
+	for _, node := range line.Moves {
+		mvs = append(mvs, node.Move)
+	}
+	return mvs
+}
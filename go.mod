@@ -1,6 +1,8 @@
 module github.com/fuyuntt/cchess
 
 go 1.14
+
 require (
 	github.com/sirupsen/logrus v1.7.0
+	golang.org/x/text v0.13.0
 )
@@ -12,12 +12,15 @@ import (
 	"time"
 
 	"github.com/fuyuntt/cchess/client"
+	"github.com/fuyuntt/cchess/ppos"
 	"github.com/fuyuntt/cchess/ucci"
+	"github.com/fuyuntt/cchess/util"
 	"github.com/sirupsen/logrus"
 )
 
 var serverMode = flag.Bool("s", false, "open server mode")
 var port = flag.Int("p", 1234, "server mode listening port")
+var bookFile = flag.String("b", "", "server mode opening book file")
 
 type MyFormatter struct{}
 
@@ -29,34 +32,82 @@ func (s *MyFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 
 func main() {
 	flag.Parse()
-	file, err := os.Create("chess.log")
-	if err == nil {
-		logrus.SetOutput(file)
-		logrus.SetFormatter(&MyFormatter{})
+	if flag.Arg(0) == "perft" {
+		os.Exit(perft(flag.Args()[1:], os.Stdout))
 	}
+	logrus.SetFormatter(&MyFormatter{})
 	if *serverMode {
-		networkEngine(*port)
+		// 引擎模式的日志文件由LogFile选项管理
+		file, err := util.OpenLogFile(util.DefaultLogFile)
+		if err == nil {
+			logrus.SetOutput(file)
+		}
+		networkEngine(*port, *bookFile)
 	} else {
 		deal(os.Stdin, os.Stdout)
 	}
 }
 
 // 网络引擎 需配合gui客户端使用
-func networkEngine(port int) {
+func networkEngine(port int, bookFile string) {
+	var book *ppos.Book
+	if bookFile != "" {
+		var err error
+		if book, err = ppos.OpenBook(bookFile); err != nil {
+			logrus.Errorf("open book failure. err=%v", err)
+		}
+	}
 	http.HandleFunc("/api/is-legal-move", client.LegalMove)
 	http.HandleFunc("/api/get-legal-moves", client.GetLegalMoves)
 	http.HandleFunc("/api/think", client.Think)
+	http.HandleFunc("/api/export-moves", client.ExportMoves)
+	http.HandleFunc("/api/book-moves", client.BookMoves(book))
 	logrus.Infof("start http server on port: %d", port)
 	err := http.ListenAndServe(":"+strconv.Itoa(port), nil)
 	logrus.Errorf("stop server. err=%v", err)
 }
 
+// 命令行 perft <depth> [fen]，按根节点着法输出叶子节点数
+func perft(args []string, writer io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintln(writer, "usage: perft <depth> [fen]")
+		return 2
+	}
+	depth, err := strconv.Atoi(args[0])
+	if err != nil || depth <= 0 {
+		fmt.Fprintf(writer, "invalid depth: %s\n", args[0])
+		return 2
+	}
+	pos, err := ppos.CreatePositionFromPosStr("startpos")
+	if len(args) > 1 {
+		pos, err = ppos.ParseFEN(strings.Join(args[1:], " "))
+	}
+	if err != nil {
+		fmt.Fprintf(writer, "invalid fen: %v\n", err)
+		return 2
+	}
+	start := time.Now()
+	var total int64
+	for _, result := range pos.Divide(depth) {
+		fmt.Fprintf(writer, "%s: %d\n", result.Move.ICCS(), result.Nodes)
+		total += result.Nodes
+	}
+	elapsed := time.Since(start)
+	// 层数很浅时可能在计时精度内完成
+	var nps int64
+	if elapsed > 0 {
+		nps = int64(float64(total) / elapsed.Seconds())
+	}
+	fmt.Fprintf(writer, "\nnodes: %d\ntime: %dms\nnps: %d\n", total, elapsed.Milliseconds(), nps)
+	return 0
+}
+
 func deal(reader io.Reader, writer io.Writer) {
 	engine := ucci.CreateEngine()
 	scanner := bufio.NewScanner(reader)
+	ctx := ucci.CreateCmdCtx(writer)
 	for scanner.Scan() {
 		cmd := scanner.Text()
-		ctx := ucci.CreateCmdCtx(writer)
 		engine.ExecCommand(ctx, cmd)
 		if cmd == "quit" {
 			logrus.Infof("engine quit")
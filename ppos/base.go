@@ -104,6 +104,11 @@ func (mv Move) ICCS() string {
 	)
 }
 
+// 左右对称的着法
+func (mv Move) Mirror() Move {
+	return GetMove(mv.Src().Mirror(), mv.Dst().Mirror())
+}
+
 func GetMove(src Square, dst Square) Move {
 	return Move(dst<<8 + src)
 }
@@ -151,6 +156,11 @@ func (sq Square) String() string {
 func (sq Square) Flip() Square {
 	return 0xfe - sq
 }
+
+// 左右对称的位置
+func (sq Square) Mirror() Square {
+	return sq&0xf0 | (0x0e - sq&0x0f)
+}
 func GetSquare(x, y int) Square {
 	x += 3
 	y += 3
@@ -386,6 +396,41 @@ var mvvLvaPieceValue = []int{
 	5, 1, 1, 3, 4, 3, 2, 0,
 }
 
+// 判断能否走空着用的子力价值
+var nonPawnValue = [7]int{0, 1, 1, 4, 9, 4, 0}
+
+// 能过河进攻的棋子(车马炮兵)，双方都没有时判和
+var attackerCount = [7]int{0, 0, 0, 1, 1, 1, 1}
+
+// 空着裁剪减少的深度
+const nullReduction = 2
+
+// 子力大于该值时才走空着
+const nullOkayMargin = 8
+
+// 子力大于该值时空着裁剪不需要检验
+const nullSafeMargin = 16
+
+// 剩余深度不超过该值时做无望裁剪，余量按剩余深度索引
+const futilityDepth = 2
+
+var futilityMargin = [futilityDepth + 1]int{0, 50, 100}
+
+// 剩余深度不超过该值时做静态空着裁剪，余量随深度增加
+const reverseFutilityDepth = 3
+const reverseFutilityMargin = 40
+
+// 剩余深度不超过该值时做剃刀裁剪，余量按剩余深度索引
+const razorDepth = 2
+
+var razorMargin = [razorDepth + 1]int{0, 100, 160}
+
+// 渴望窗口的初始半宽
+const aspirationWindow = 16
+
+// 深度较浅时直接用完整窗口
+const aspirationMinDepth = 4
+
 var lineMoveDelta = [4]Square{-0x10, -0x01, +0x01, +0x10}
 var advisorMoveTab = [4]Square{-0x11, -0x0f, +0x0f, +0x11}
 var bishopMoveTab = [4]Square{-0x22, -0x1e, +0x1e, +0x22}
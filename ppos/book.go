@@ -0,0 +1,192 @@
+package ppos
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"sort"
+)
+
+// 开局库文件中每条记录的长度：8字节局面zobrist、2字节着法、2字节权重，大端序
+const bookEntrySize = 12
+
+// 开局库中的一个着法，权重越大被选中的机会越大
+type BookMove struct {
+	Move   Move
+	Weight int
+}
+
+type bookEntry struct {
+	key    ZobristHash
+	move   Move
+	weight uint16
+}
+
+// 开局库，按局面的zobrist查找着法，左右对称的局面共用同一条记录
+// zobrist由固定种子生成，开局库文件在不同版本间通用
+type Book struct {
+	// 按zobrist和着法排序
+	entries []bookEntry
+}
+
+func CreateBook() *Book {
+	return &Book{}
+}
+
+// 打开开局库文件
+func OpenBook(path string) (*Book, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadBook(bufio.NewReader(file))
+}
+
+// 读取开局库
+func ReadBook(r io.Reader) (*Book, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%bookEntrySize != 0 {
+		return nil, fmt.Errorf("illegal book size: %d", len(data))
+	}
+	book := &Book{entries: make([]bookEntry, 0, len(data)/bookEntrySize)}
+	for i := 0; i < len(data); i += bookEntrySize {
+		book.entries = append(book.entries, bookEntry{
+			key:    ZobristHash(binary.BigEndian.Uint64(data[i:])),
+			move:   Move(binary.BigEndian.Uint16(data[i+8:])),
+			weight: binary.BigEndian.Uint16(data[i+10:]),
+		})
+	}
+	sort.Slice(book.entries, func(i, j int) bool {
+		return book.entries[i].less(book.entries[j].key, book.entries[j].move)
+	})
+	return book, nil
+}
+
+func (entry bookEntry) less(key ZobristHash, mv Move) bool {
+	return entry.key < key || (entry.key == key && entry.move < mv)
+}
+
+// 写出开局库
+func (book *Book) WriteTo(w io.Writer) (int64, error) {
+	buf := make([]byte, bookEntrySize)
+	var n int64
+	for _, entry := range book.entries {
+		binary.BigEndian.PutUint64(buf, uint64(entry.key))
+		binary.BigEndian.PutUint16(buf[8:], uint16(entry.move))
+		binary.BigEndian.PutUint16(buf[10:], entry.weight)
+		written, err := w.Write(buf)
+		n += int64(written)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// 开局库中的记录数
+func (book *Book) Len() int {
+	return len(book.entries)
+}
+
+// 增加局面下的着法，已有的着法累加权重
+func (book *Book) Add(pos *Position, mv Move, weight int) {
+	key := pos.zobrist
+	i := sort.Search(len(book.entries), func(i int) bool {
+		return !book.entries[i].less(key, mv)
+	})
+	if i < len(book.entries) && book.entries[i].key == key && book.entries[i].move == mv {
+		weight += int(book.entries[i].weight)
+	} else {
+		book.entries = append(book.entries, bookEntry{})
+		copy(book.entries[i+1:], book.entries[i:])
+	}
+	if weight > 0xffff {
+		weight = 0xffff
+	}
+	book.entries[i] = bookEntry{key, mv, uint16(weight)}
+}
+
+// 局面下的全部开局库着法，包括左右对称局面的着法，按权重从大到小排列
+// 由于zobrist可能冲突，只返回合法的着法
+func (book *Book) Moves(pos *Position) []BookMove {
+	var moves []BookMove
+	add := func(mv Move, weight int) {
+		for i := range moves {
+			if moves[i].Move == mv {
+				moves[i].Weight += weight
+				return
+			}
+		}
+		if pos.LegalMove(mv) {
+			moves = append(moves, BookMove{mv, weight})
+		}
+	}
+	for _, entry := range book.lookup(pos.zobrist) {
+		add(entry.move, int(entry.weight))
+	}
+	if mirror := pos.mirrorZobrist(); mirror != pos.zobrist {
+		for _, entry := range book.lookup(mirror) {
+			add(entry.move.Mirror(), int(entry.weight))
+		}
+	}
+	sort.SliceStable(moves, func(i, j int) bool {
+		return moves[i].Weight > moves[j].Weight
+	})
+	return moves
+}
+
+func (book *Book) lookup(key ZobristHash) []bookEntry {
+	i := sort.Search(len(book.entries), func(i int) bool {
+		return book.entries[i].key >= key
+	})
+	j := i
+	for j < len(book.entries) && book.entries[j].key == key {
+		j++
+	}
+	return book.entries[i:j]
+}
+
+// 按权重随机选择开局库着法，allowed不为空时只在允许的着法中选择
+func (book *Book) Probe(pos *Position, rnd *rand.Rand, allowed func(mv Move) bool) (Move, bool) {
+	var moves []BookMove
+	total := 0
+	for _, bookMove := range book.Moves(pos) {
+		if bookMove.Weight > 0 && (allowed == nil || allowed(bookMove.Move)) {
+			moves = append(moves, bookMove)
+			total += bookMove.Weight
+		}
+	}
+	if total == 0 {
+		return MvNop, false
+	}
+	r := rnd.Intn(total)
+	for _, bookMove := range moves {
+		if r < bookMove.Weight {
+			return bookMove.Move, true
+		}
+		r -= bookMove.Weight
+	}
+	return MvNop, false
+}
+
+// 左右对称局面的zobrist
+func (pos *Position) mirrorZobrist() ZobristHash {
+	var zobrist ZobristHash
+	for sq := SqStart; sq <= SqEnd; sq++ {
+		if pc := pos.pcSquares[sq]; pc != PcNop {
+			zobrist ^= GetZobrist(sq.Mirror(), pc)
+		}
+	}
+	if pos.playerSd == SdBlack {
+		zobrist ^= playerZobrist
+	}
+	return zobrist
+}
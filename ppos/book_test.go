@@ -0,0 +1,93 @@
+package ppos
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestBookReadWrite(t *testing.T) {
+	book := CreateBook()
+	start := mustPosStr(t, "startpos")
+	book.Add(start, GetMoveFromICCS("h2e2"), 100)
+	book.Add(start, GetMoveFromICCS("b0c2"), 20)
+	book.Add(start, GetMoveFromICCS("h2e2"), 50)
+	book.Add(mustPosStr(t, "startpos moves h2e2"), GetMoveFromICCS("h9g7"), 0x10000)
+	if book.Len() != 3 {
+		t.Fatalf("expect 3 entries, got %d", book.Len())
+	}
+	var buf bytes.Buffer
+	if n, err := book.WriteTo(&buf); err != nil || n != 3*bookEntrySize {
+		t.Fatalf("write book: %d, %v", n, err)
+	}
+	read, err := ReadBook(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, book) {
+		t.Errorf("book changed after round trip")
+	}
+	expect := []BookMove{{GetMoveFromICCS("h2e2"), 150}, {GetMoveFromICCS("b0c2"), 20}}
+	if moves := read.Moves(start); !reflect.DeepEqual(moves, expect) {
+		t.Errorf("expect %v, got %v", expect, moves)
+	}
+	// 权重超出范围时取最大值
+	if moves := read.Moves(mustPosStr(t, "startpos moves h2e2")); len(moves) != 1 || moves[0].Weight != 0xffff {
+		t.Errorf("unexpected moves %v", moves)
+	}
+	if _, err := ReadBook(bytes.NewReader(make([]byte, bookEntrySize+1))); err == nil {
+		t.Errorf("expect illegal book size error")
+	}
+}
+
+func TestBookMirror(t *testing.T) {
+	pos := mustPosStr(t, "startpos moves h2e2")
+	mirror := mustPosStr(t, "startpos moves b2e2")
+	if pos.mirrorZobrist() != mirror.zobrist || mirror.mirrorZobrist() != pos.zobrist {
+		t.Fatalf("mirror zobrist mismatch")
+	}
+	book := CreateBook()
+	book.Add(pos, GetMoveFromICCS("h9g7"), 10)
+	book.Add(mirror, GetMoveFromICCS("h9g7"), 5)
+	// 对称局面中的着法按对称后的着法合并
+	expect := []BookMove{{GetMoveFromICCS("b9c7"), 10}, {GetMoveFromICCS("h9g7"), 5}}
+	if moves := book.Moves(mirror); !reflect.DeepEqual(moves, expect) {
+		t.Errorf("expect %v, got %v", expect, moves)
+	}
+	book.Add(mirror, GetMoveFromICCS("b9c7"), 1)
+	if moves := book.Moves(pos); len(moves) != 2 || moves[0] != (BookMove{GetMoveFromICCS("h9g7"), 11}) {
+		t.Errorf("unexpected moves %v", moves)
+	}
+}
+
+func TestBookProbe(t *testing.T) {
+	start := mustPosStr(t, "startpos")
+	book := CreateBook()
+	book.Add(start, GetMoveFromICCS("h2e2"), 3)
+	book.Add(start, GetMoveFromICCS("b0c2"), 1)
+	book.Add(start, GetMoveFromICCS("c3c4"), 0)
+	// 非法着法不会被选中
+	book.Add(start, GetMoveFromICCS("a0a5"), 100)
+	rnd := rand.New(rand.NewSource(1))
+	counts := make(map[Move]int)
+	for i := 0; i < 4000; i++ {
+		mv, ok := book.Probe(start, rnd, nil)
+		if !ok {
+			t.Fatal("expect book move")
+		}
+		counts[mv]++
+	}
+	if len(counts) != 2 || counts[GetMoveFromICCS("h2e2")] < 2700 || counts[GetMoveFromICCS("b0c2")] < 800 {
+		t.Errorf("unexpected distribution %v", counts)
+	}
+	onlyKnight := func(mv Move) bool {
+		return mv == GetMoveFromICCS("b0c2")
+	}
+	if mv, ok := book.Probe(start, rnd, onlyKnight); !ok || mv != GetMoveFromICCS("b0c2") {
+		t.Errorf("expect b0c2, got %v", mv)
+	}
+	if _, ok := book.Probe(mustPosStr(t, "startpos moves h2e2"), rnd, nil); ok {
+		t.Errorf("expect no book move")
+	}
+}
@@ -0,0 +1,151 @@
+package ppos
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+var chinesePieceNames = [3][7]string{
+	SdRed:   {"帅", "仕", "相", "马", "车", "炮", "兵"},
+	SdBlack: {"将", "士", "象", "马", "车", "炮", "卒"},
+}
+
+// 红方用中文数字，黑方用全角数字
+var chineseNumbers = [3][10]string{
+	SdRed:   {"", "一", "二", "三", "四", "五", "六", "七", "八", "九"},
+	SdBlack: {"", "１", "２", "３", "４", "５", "６", "７", "８", "９"},
+}
+
+var chineseActions = map[byte]string{'+': "进", '-': "退", '.': "平"}
+
+// 中文纵线记法，如炮二平五、马８进７、前车进一
+// 同一纵线上两个棋子用前、后区分，三个兵(卒)用前、中、后，更多时用一、二、三、四、五
+func (pos *Position) MoveToChinese(mv Move) string {
+	rec := pos.moveRecord(mv)
+	sd := pos.pcSquares[mv.Src()].GetSide()
+	var sb strings.Builder
+	if rec.count > 1 {
+		sb.WriteString(chineseOrder(rec.order, rec.count))
+		if rec.tandemFiles {
+			sb.WriteString(chineseNumbers[sd][rec.file])
+		} else {
+			sb.WriteString(chinesePieceNames[sd][rec.pt])
+		}
+	} else {
+		sb.WriteString(chinesePieceNames[sd][rec.pt])
+		sb.WriteString(chineseNumbers[sd][rec.file])
+	}
+	sb.WriteString(chineseActions[rec.action])
+	sb.WriteString(chineseNumbers[sd][rec.num])
+	return sb.String()
+}
+
+func chineseOrder(order, count int) string {
+	switch {
+	case count > 3:
+		return chineseNumbers[SdRed][order]
+	case order == 1:
+		return "前"
+	case order == count:
+		return "后"
+	default:
+		return "中"
+	}
+}
+
+// 解析中文纵线记法，兼容繁体字以及中文数字、全角和半角数字
+func (pos *Position) ParseChinese(str string) (Move, error) {
+	runes := []rune(strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, str))
+	if len(runes) != 4 {
+		return MvNop, fmt.Errorf("illegal chinese move: %s", str)
+	}
+	q := recordQuery{pt: -1}
+	if pt, ok := chinesePieceType(runes[0]); ok {
+		// 车二进一
+		q.pt, q.file = pt, chineseDigit(runes[1])
+		if q.file == 0 {
+			return MvNop, fmt.Errorf("illegal chinese move: %s", str)
+		}
+	} else {
+		// 前车进一、前七进一
+		q.order = chineseOrderMark(runes[0])
+		if pt, ok := chinesePieceType(runes[1]); ok {
+			q.pt = pt
+		} else {
+			q.file = chineseDigit(runes[1])
+		}
+		if q.order == 0 || (q.pt < 0 && q.file == 0) {
+			return MvNop, fmt.Errorf("illegal chinese move: %s", str)
+		}
+	}
+	switch runes[2] {
+	case '进', '進':
+		q.action = '+'
+	case '退':
+		q.action = '-'
+	case '平':
+		q.action = '.'
+	default:
+		return MvNop, fmt.Errorf("illegal chinese move: %s", str)
+	}
+	if q.num = chineseDigit(runes[3]); q.num == 0 {
+		return MvNop, fmt.Errorf("illegal chinese move: %s", str)
+	}
+	return pos.findRecord(q, str)
+}
+
+func chinesePieceType(r rune) (PieceType, bool) {
+	switch r {
+	case '帅', '帥', '将', '將':
+		return PtKing, true
+	case '仕', '士':
+		return PtAdvisor, true
+	case '相', '象':
+		return PtBishop, true
+	case '马', '馬', '傌':
+		return PtKnight, true
+	case '车', '車', '俥':
+		return PtRook, true
+	case '炮', '砲', '包':
+		return PtCannon, true
+	case '兵', '卒':
+		return PtPawn, true
+	default:
+		return 0, false
+	}
+}
+
+// 1-9，不是数字时返回0
+func chineseDigit(r rune) int {
+	switch {
+	case r >= '1' && r <= '9':
+		return int(r - '0')
+	case r >= '１' && r <= '９':
+		return int(r - '０')
+	}
+	if i := strings.IndexRune("一二三四五六七八九", r); i >= 0 {
+		return i/len("一") + 1
+	}
+	return 0
+}
+
+func chineseOrderMark(r rune) byte {
+	switch r {
+	case '前':
+		return 'f'
+	case '中':
+		return 'm'
+	case '后', '後':
+		return 'r'
+	}
+	if n := chineseDigit(r); n > 0 && n <= 5 {
+		return byte('0' + n)
+	}
+	return 0
+}
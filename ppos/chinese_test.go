@@ -0,0 +1,123 @@
+package ppos
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMoveToChinese(t *testing.T) {
+	tests := []struct {
+		position string
+		move     string
+		chinese  string
+	}{
+		{"startpos", "h2e2", "炮二平五"},
+		{"startpos", "b0c2", "马八进七"},
+		{"startpos", "c0e2", "相七进五"},
+		{"startpos", "f0e1", "仕四进五"},
+		{"startpos", "a0a2", "车九进二"},
+		{"startpos moves h2e2", "h9g7", "马８进７"},
+		{"startpos moves h2e2", "h7h0", "炮８进７"},
+		{"startpos moves h2e2", "e9e8", "将５进１"},
+		{"fen 4k4/9/9/9/9/9/4R4/9/4R4/4K4 w", "e3e5", "前车进二"},
+		{"fen 4k4/9/9/9/9/9/4R4/9/4R4/4K4 w", "e1d1", "后车平六"},
+		{"fen 4k4/9/9/9/9/9/4R4/9/4R4/4K4 w", "e3e2", "前车退一"},
+		// 三个兵和多条纵线上的兵
+		{"fen 3k5/9/2P6/2P3P2/2P3P2/9/9/9/9/4K4 w", "c7c8", "前七进一"},
+		{"fen 3k5/9/2P6/2P3P2/2P3P2/9/9/9/9/4K4 w", "c6b6", "中七平八"},
+		{"fen 3k5/9/2P6/2P3P2/2P3P2/9/9/9/9/4K4 w", "g5f5", "后三平四"},
+		{"fen 3k5/9/2P6/2P6/2P6/2P6/9/9/9/4K4 w", "c5b5", "三兵平八"},
+		{"fen 4k4/9/9/9/9/9/9/4p4/4p4/3K5 b", "e1d1", "前卒平４"},
+	}
+	for _, test := range tests {
+		pos := mustPosStr(t, test.position)
+		if chinese := pos.MoveToChinese(GetMoveFromICCS(test.move)); chinese != test.chinese {
+			t.Errorf("%s %s: expect %s, got %s", test.position, test.move, test.chinese, chinese)
+		}
+	}
+}
+
+func TestParseChinese(t *testing.T) {
+	tests := []struct {
+		position string
+		chinese  string
+		move     string
+	}{
+		{"startpos", "炮二平五", "h2e2"},
+		{"startpos", "炮2平5", "h2e2"},
+		{"startpos", "炮２平５", "h2e2"},
+		{"startpos", "砲二平五", "h2e2"},
+		{"startpos", "俥一進一", "i0i1"},
+		{"startpos", " 马 二 进 三 ", "h0g2"},
+		{"startpos moves h2e2", "马8进7", "h9g7"},
+		{"startpos moves h2e2", "馬８進７", "h9g7"},
+		{"startpos moves h2e2", "包8平5", "h7e7"},
+		{"fen 4k4/9/9/9/9/9/4R4/9/4R4/4K4 w", "前車進二", "e3e5"},
+		{"fen 3k5/9/2P6/2P3P2/2P3P2/9/9/9/9/4K4 w", "中7平8", "c6b6"},
+		// 没有歧义时可以不写前后
+		{"fen 4k4/9/9/9/9/9/4R4/9/4R4/4K4 w", "车五进二", "e3e5"},
+	}
+	for _, test := range tests {
+		pos := mustPosStr(t, test.position)
+		mv, err := pos.ParseChinese(test.chinese)
+		if err != nil {
+			t.Errorf("%s %s: %v", test.position, test.chinese, err)
+		} else if mv.ICCS() != test.move {
+			t.Errorf("%s %s: expect %s, got %s", test.position, test.chinese, test.move, mv.ICCS())
+		}
+	}
+	for _, illegal := range []string{"炮二进五", "炮二平", "兵一进二", "前炮进一", "车二进一x"} {
+		if mv, err := mustPosStr(t, "startpos").ParseChinese(illegal); err == nil {
+			t.Errorf("%s: expect error, got %s", illegal, mv.ICCS())
+		}
+	}
+	// 后车也能进一步，不写前后有歧义
+	if _, err := mustPosStr(t, "fen 4k4/9/9/9/9/9/4R4/9/4R4/4K4 w").ParseChinese("车五进一"); err == nil {
+		t.Errorf("expect ambiguous move error")
+	}
+}
+
+func TestChineseRoundTrip(t *testing.T) {
+	for _, test := range perftSuite {
+		pos, _ := CreatePositionFromFenStr(test.fen)
+		for _, mv := range pos.legalMoves() {
+			chinese := pos.MoveToChinese(mv)
+			if parsed, err := pos.ParseChinese(chinese); err != nil || parsed != mv {
+				t.Errorf("%s %s %s: got %s, %v", test.fen, mv.ICCS(), chinese, parsed.ICCS(), err)
+			}
+			// 半角数字
+			halfWidth := strings.Map(func(r rune) rune {
+				if r >= '１' && r <= '９' {
+					return r - '１' + '1'
+				}
+				return r
+			}, chinese)
+			if parsed, err := pos.ParseChinese(halfWidth); err != nil || parsed != mv {
+				t.Errorf("%s %s %s: got %s, %v", test.fen, mv.ICCS(), halfWidth, parsed.ICCS(), err)
+			}
+		}
+	}
+}
+
+func TestExportMoves(t *testing.T) {
+	pos := mustPosStr(t, "startpos moves h2e2 h9g7 h0g2 i9h9")
+	expect := []string{"炮二平五", "马８进７", "马二进三", "车９平８"}
+	if moves := pos.ExportMoves(NotationChinese); !reflect.DeepEqual(moves, expect) {
+		t.Errorf("expect %v, got %v", expect, moves)
+	}
+	if moves := pos.ExportMoves(NotationICCS); !reflect.DeepEqual(moves, []string{"h2e2", "h9g7", "h0g2", "i9h9"}) {
+		t.Errorf("unexpected iccs moves %v", moves)
+	}
+	if pos.FenString() != mustPosStr(t, "startpos moves h2e2 h9g7 h0g2 i9h9").FenString() {
+		t.Errorf("position changed after export: %s", pos.FenString())
+	}
+}
+
+func mustPosStr(t *testing.T, position string) *Position {
+	pos, err := CreatePositionFromPosStr(position)
+	if err != nil {
+		t.Fatalf("%s: %v", position, err)
+	}
+	return pos
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/fuyuntt/cchess/util"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -27,7 +28,7 @@ var pieceMap = map[int32]Piece{
 
 const initFen = "rnbakabnr/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C5C1/9/RNBAKABNR w - - 0 1"
 
-var positionRegexp = regexp.MustCompile(`^(?:fen (?P<fen>[kabnrcpKABNRCP1-9/]+ [wrb] - - \d+ \d+)|(?P<startpos>startpos))(?: moves (?P<moves>[a-i]\d[a-i]\d(?: [a-i]\d[a-i]\d)*))?$`)
+var positionRegexp = regexp.MustCompile(`^(?:fen (?P<fen>[kabnrcpKABNRCP1-9/]+ [wrb](?: (?:-|\d+))*)|(?P<startpos>startpos))(?: moves (?P<moves>[a-i]\d[a-i]\d(?: [a-i]\d[a-i]\d)*))?$`)
 
 func parsePosition(positionStr string) (*Position, error) {
 	groups := util.ParseGroup(positionRegexp, positionStr)
@@ -60,28 +61,196 @@ func parsePosition(positionStr string) (*Position, error) {
 	}
 	return pos, nil
 }
+
+// FEN错误的类型
+type FenErrorKind int8
+
+const (
+	// 字段数、行数、每行格数不对或有不认识的字符
+	FenErrSyntax FenErrorKind = iota
+	// 走棋方不是w、r或b
+	FenErrSide
+	// 回合数不是合法的数字
+	FenErrCounter
+	// 缺少或多出帅(将)
+	FenErrKing
+	// 某种棋子的数量超过规定
+	FenErrPieceCount
+	// 棋子在不可能到达的位置
+	FenErrSquare
+	// 不该走棋的一方被将军，包括将帅对脸
+	FenErrCheck
+)
+
+func (kind FenErrorKind) String() string {
+	return [...]string{"syntax", "side", "counter", "king", "piece count", "square", "check"}[kind]
+}
+
+// FEN中的一处错误
+type FenError struct {
+	Kind FenErrorKind
+	// 出错的格子，与格子无关时为0
+	Square Square
+	Msg    string
+}
+
+func (err *FenError) Error() string {
+	if err.Square != 0 {
+		return fmt.Sprintf("fen %s error at %s: %s", err.Kind, squareICCS(err.Square), err.Msg)
+	}
+	return fmt.Sprintf("fen %s error: %s", err.Kind, err.Msg)
+}
+
+// 严格模式下FEN中的全部错误
+type FenErrors []*FenError
+
+func (errs FenErrors) Error() string {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// 每方各种棋子的最大数量
+var maxPieceCount = [7]int{1, 2, 2, 2, 2, 2, 5}
+
+// 严格解析FEN，棋子数量、位置和将军状态都必须合法，否则返回FenErrors
+// 走棋方可以用w或r表示红方，b表示黑方；回合数可以省略
+func ParseFEN(fenStr string) (*Position, error) {
+	return parseFenMode(fenStr, false)
+}
+
+// 宽松解析FEN，只检查格式，用于摆残局、排局等不一定合法的局面
+func ParseFENLenient(fenStr string) (*Position, error) {
+	return parseFenMode(fenStr, true)
+}
+
 func parseFen(fenStr string) (*Position, error) {
+	return parseFenMode(fenStr, true)
+}
+
+func parseFenMode(fenStr string, lenient bool) (*Position, error) {
 	pos := CreatePosition()
-	fenParts := strings.Split(fenStr, " ")
-	x, y := 0, 0
-	for _, b := range fenParts[0] {
-		if b >= '0' && b <= '9' {
-			x += int(b - '0')
-		} else if b == '/' {
-			y++
-			x = 0
-		} else {
+	fenParts := strings.Fields(fenStr)
+	if len(fenParts) < 2 || len(fenParts) > 6 {
+		return nil, &FenError{Kind: FenErrSyntax, Msg: fmt.Sprintf("expect 2 to 6 fields, got %d: %s", len(fenParts), fenStr)}
+	}
+	ranks := strings.Split(fenParts[0], "/")
+	if len(ranks) != 10 {
+		return nil, &FenError{Kind: FenErrSyntax, Msg: fmt.Sprintf("expect 10 ranks, got %d", len(ranks))}
+	}
+	for y, rank := range ranks {
+		x := 0
+		for _, b := range rank {
+			if b >= '1' && b <= '9' {
+				x += int(b - '0')
+				continue
+			}
 			piece, ok := pieceMap[b]
 			if !ok {
-				return nil, fmt.Errorf("fen parse error: %s", fenStr)
+				return nil, &FenError{Kind: FenErrSyntax, Msg: fmt.Sprintf("illegal piece %q in rank %d", b, 9-y)}
+			}
+			if x < 9 {
+				pos.AddPiece(GetSquare(x, y), piece)
 			}
-			pos.AddPiece(GetSquare(x, y), piece)
 			x++
 		}
+		if x != 9 {
+			return nil, &FenError{Kind: FenErrSyntax, Msg: fmt.Sprintf("rank %d has %d files", 9-y, x)}
+		}
 	}
-	side := fenParts[1]
-	if side == "b" {
+	switch fenParts[1] {
+	case "w", "r":
+	case "b":
 		pos.ChangeSide()
+	default:
+		return nil, &FenError{Kind: FenErrSide, Msg: fmt.Sprintf("illegal side to move: %s", fenParts[1])}
+	}
+	// 未吃子的半回合数和回合数
+	if len(fenParts) > 4 {
+		noCapture, err := strconv.Atoi(fenParts[4])
+		if err != nil || noCapture < 0 {
+			return nil, &FenError{Kind: FenErrCounter, Msg: fmt.Sprintf("illegal halfmove clock: %s", fenParts[4])}
+		}
+		pos.noCapture = noCapture
+	}
+	if len(fenParts) > 5 {
+		fullMove, err := strconv.Atoi(fenParts[5])
+		if err != nil || fullMove < 1 {
+			return nil, &FenError{Kind: FenErrCounter, Msg: fmt.Sprintf("illegal fullmove number: %s", fenParts[5])}
+		}
+		pos.fullMove = fullMove
+	}
+	if lenient {
+		return pos, nil
+	}
+	if errs := pos.validate(); len(errs) > 0 {
+		return nil, errs
 	}
 	return pos, nil
 }
+
+// 检查棋子数量、位置和将军状态
+func (pos *Position) validate() FenErrors {
+	var errs FenErrors
+	var counts [24]int
+	for sq := SqStart; sq <= SqEnd; sq++ {
+		pc := pos.pcSquares[sq]
+		if pc == PcNop {
+			continue
+		}
+		counts[pc]++
+		if !legalPieceSquare(pc, sq) {
+			errs = append(errs, &FenError{Kind: FenErrSquare, Square: sq, Msg: fmt.Sprintf("%v can not be here", pc)})
+		}
+	}
+	for _, sd := range []Side{SdRed, SdBlack} {
+		if n := counts[GetPiece(PtKing, sd)]; n != 1 {
+			errs = append(errs, &FenError{Kind: FenErrKing, Msg: fmt.Sprintf("%v has %d kings", sd, n)})
+		}
+		for pt := PtAdvisor; pt <= PtPawn; pt++ {
+			pc := GetPiece(pt, sd)
+			if counts[pc] > maxPieceCount[pt] {
+				errs = append(errs, &FenError{Kind: FenErrPieceCount, Msg: fmt.Sprintf("too many %v: %d", pc, counts[pc])})
+			}
+		}
+	}
+	if len(errs) == 0 {
+		// 不该走棋的一方被将军
+		pos.ChangeSide()
+		if pos.Checked() {
+			errs = append(errs, &FenError{Kind: FenErrCheck, Msg: fmt.Sprintf("%v is in check but not to move", pos.playerSd)})
+		}
+		pos.ChangeSide()
+	}
+	return errs
+}
+
+// 棋子能否出现在该格子，黑方棋子翻转成红方判断
+// 帅(将)、仕(士)不出九宫，相(象)不过河，兵(卒)不会在出发的位置后面
+func legalPieceSquare(pc Piece, sq Square) bool {
+	if !sq.InBoard() {
+		return false
+	}
+	if pc.GetSide() == SdBlack {
+		sq = sq.Flip()
+	}
+	x, y := sq.GetX(), sq.GetY()
+	switch pc.GetType() {
+	case PtKing:
+		return sq.InFort() && y >= 7
+	case PtAdvisor:
+		return sq.InFort() && y >= 7 && (x+y)%2 == 0
+	case PtBishop:
+		return y >= 5 && y%2 == 1 && x%2 == 0 && (x/2+(y-1)/2)%2 == 1
+	case PtPawn:
+		return y <= 4 || (y <= 6 && x%2 == 0)
+	}
+	return true
+}
+
+// 格子的ICCS坐标，如e0
+func squareICCS(sq Square) string {
+	return string([]rune{rune('a' + sq.GetX()), rune('0' + 9 - sq.GetY())})
+}
@@ -0,0 +1,76 @@
+package ppos
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseFEN(t *testing.T) {
+	// 红方可以用w或r表示，回合数可以省略
+	for _, fen := range []string{initFen, "rnbakabnr/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C5C1/9/RNBAKABNR r - - 0 1",
+		"rnbakabnr/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C5C1/9/RNBAKABNR w"} {
+		pos, err := ParseFEN(fen)
+		if err != nil {
+			t.Fatalf("%s: %v", fen, err)
+		}
+		if pos.FenString() != initFen {
+			t.Errorf("expect %s, got %s", initFen, pos.FenString())
+		}
+	}
+	// 回合数往返不变
+	fen := "2bakab2/9/2n1c1n2/p3p3p/2p3p2/9/P1P1P1P1P/1C2C1N2/9/RNBAKAB1R b - - 13 27"
+	if pos, err := ParseFEN(fen); err != nil || pos.FenString() != fen {
+		t.Errorf("round trip failure: %v, %v", pos, err)
+	}
+}
+
+func TestParseFENErrors(t *testing.T) {
+	tests := []struct {
+		fen   string
+		kinds []FenErrorKind
+	}{
+		{"rnbakabnr/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C5C1/RNBAKABNR w - - 0 1", []FenErrorKind{FenErrSyntax}},
+		{"rnbakabnr/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C5C2/9/RNBAKABNR w - - 0 1", []FenErrorKind{FenErrSyntax}},
+		{"rnbakabnr/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C5C1/9/RNBAKABNX w - - 0 1", []FenErrorKind{FenErrSyntax}},
+		{"rnbakabnr/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C5C1/9/RNBAKABNR x - - 0 1", []FenErrorKind{FenErrSide}},
+		{"rnbakabnr/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C5C1/9/RNBAKABNR w - - -1 1", []FenErrorKind{FenErrCounter}},
+		{"rnbakabnr/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C5C1/9/RNBA1ABNR w - - 0 1", []FenErrorKind{FenErrKing}},
+		{"rnbakabnr/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C5C1/R8/RNBAKABNR w - - 0 1", []FenErrorKind{FenErrPieceCount}},
+		// 象过河，士出九宫，兵在出发位置后面
+		{"rnbakabnr/9/1c5c1/p1p1p1p1p/2B6/9/P1P1P1P1P/1C5C1/9/RN1AKABNR w - - 0 1", []FenErrorKind{FenErrSquare}},
+		{"rnbakabnr/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C5C1/9/RNBAKABNR w - - 0 1", nil},
+		{"rnbakabnr/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C5C1/P8/RNBAKABNR w - - 0 1", []FenErrorKind{FenErrSquare, FenErrPieceCount}},
+		{"4k4/9/9/9/9/9/9/9/3A5/4K4 w - - 0 1", []FenErrorKind{FenErrSquare}},
+		// 将帅对脸时不该走棋的一方被将军
+		{"4k4/9/9/9/9/9/9/9/9/4K4 w - - 0 1", []FenErrorKind{FenErrCheck}},
+	}
+	for _, test := range tests {
+		_, err := ParseFEN(test.fen)
+		var kinds []FenErrorKind
+		var fenErrs FenErrors
+		var fenErr *FenError
+		if errors.As(err, &fenErrs) {
+			for _, e := range fenErrs {
+				kinds = append(kinds, e.Kind)
+			}
+		} else if errors.As(err, &fenErr) {
+			kinds = append(kinds, fenErr.Kind)
+		}
+		if len(kinds) != len(test.kinds) {
+			t.Errorf("%s: expect %v, got %v", test.fen, test.kinds, err)
+			continue
+		}
+		for i := range kinds {
+			if kinds[i] != test.kinds[i] {
+				t.Errorf("%s: expect %v, got %v", test.fen, test.kinds, err)
+			}
+		}
+	}
+	// 宽松模式只检查格式
+	if _, err := ParseFENLenient("4k4/9/9/9/9/9/9/9/3A5/4K4 w - - 0 1"); err != nil {
+		t.Errorf("lenient mode should accept puzzle positions: %v", err)
+	}
+	if _, err := ParseFENLenient("4k4/9/9/9/9/9/9/9/3A5/4K4 x - - 0 1"); err == nil {
+		t.Errorf("lenient mode should reject syntax errors")
+	}
+}
@@ -0,0 +1,204 @@
+package ppos
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// 置换表默认大小(MB)
+const DefaultHashSizeMB = 16
+
+// 每个桶中的项数，一个桶正好占一个缓存行
+const bucketSize = 4
+
+// 每个桶占用的字节数
+const bucketBytes = 64
+
+type historyType uint8
+
+const (
+	hisExact historyType = iota
+	hisAlpha
+	hisBeta
+)
+
+// 置换表中的一项
+type hashEntry struct {
+	// 最佳着法
+	move  Move
+	value int16
+	depth int8
+	// 记录时的搜索代数，用于淘汰以前搜索留下的项
+	generation uint8
+	posType    historyType
+}
+
+// 压缩成一个64位整数，便于原子读写
+func (entry hashEntry) pack() uint64 {
+	return uint64(entry.move) | uint64(uint16(entry.value))<<16 | uint64(uint8(entry.depth))<<32 |
+		uint64(entry.generation)<<40 | uint64(entry.posType)<<48
+}
+
+func unpackHashEntry(data uint64) hashEntry {
+	return hashEntry{
+		move:       Move(data),
+		value:      int16(data >> 16),
+		depth:      int8(data >> 32),
+		generation: uint8(data >> 40),
+		posType:    historyType(data >> 48),
+	}
+}
+
+// 置换表的存储单元，多个线程同时读写时不加锁
+// key中存放zobrist与data的异或值，读到被其他线程写了一半的单元时校验不通过，相当于未命中
+type hashSlot struct {
+	key  uint64
+	data uint64
+}
+
+func (slot *hashSlot) load() (ZobristHash, hashEntry) {
+	key, data := atomic.LoadUint64(&slot.key), atomic.LoadUint64(&slot.data)
+	return ZobristHash(key ^ data), unpackHashEntry(data)
+}
+
+func (slot *hashSlot) store(zob ZobristHash, entry hashEntry) {
+	data := entry.pack()
+	atomic.StoreUint64(&slot.key, uint64(zob)^data)
+	atomic.StoreUint64(&slot.data, data)
+}
+
+type hashBucket [bucketSize]hashSlot
+
+// 置换表，可在多次搜索之间保留
+type HashTable struct {
+	buckets    []hashBucket
+	mask       uint64
+	generation uint8
+}
+
+// 创建sizeMB大小的置换表，桶数取不超过大小的2的幂
+func CreateHashTable(sizeMB int) *HashTable {
+	if sizeMB < 1 {
+		sizeMB = 1
+	}
+	nBuckets := uint64(1)
+	for nBuckets*2*bucketBytes <= uint64(sizeMB)<<20 {
+		nBuckets *= 2
+	}
+	return &HashTable{buckets: make([]hashBucket, nBuckets), mask: nBuckets - 1}
+}
+
+// 清空置换表
+func (table *HashTable) Clear() {
+	for i := range table.buckets {
+		table.buckets[i] = hashBucket{}
+	}
+	table.generation = 0
+}
+
+// 开始新的搜索，以前的项会被优先替换
+func (table *HashTable) newSearch() {
+	table.generation++
+}
+
+func (table *HashTable) bucket(zob ZobristHash) *hashBucket {
+	return &table.buckets[uint64(zob)&table.mask]
+}
+
+// 查找置换表，命中时返回评价值，不论是否命中都尽量返回最佳着法
+// return 是否可以截断，评价值，最佳着法
+func (table *HashTable) probe(zob ZobristHash, depth int, vlAlpha int, vlBeta int, nDistance int) (bool, int, Move) {
+	bucket := table.bucket(zob)
+	for i := range bucket {
+		key, entry := bucket[i].load()
+		if key != zob {
+			continue
+		}
+		if int(entry.depth) < depth {
+			return false, 0, entry.move
+		}
+		vl := valueFromHash(int(entry.value), nDistance)
+		if entry.posType == hisExact {
+			return true, vl, entry.move
+		} else if entry.posType == hisAlpha && vl <= vlAlpha {
+			return true, vlAlpha, entry.move
+		} else if entry.posType == hisBeta && vl >= vlBeta {
+			return true, vlBeta, entry.move
+		}
+		return false, 0, entry.move
+	}
+	return false, 0, MvNop
+}
+
+// 局面在置换表中的最佳着法
+func (table *HashTable) bestMove(zob ZobristHash) Move {
+	bucket := table.bucket(zob)
+	for i := range bucket {
+		if key, entry := bucket[i].load(); key == zob {
+			return entry.move
+		}
+	}
+	return MvNop
+}
+
+// 记录置换表，同一局面深度更深的优先保留；否则替换桶中最旧、最浅的项
+func (table *HashTable) record(zob ZobristHash, depth int, value int, posType historyType, mv Move, nDistance int) {
+	bucket := table.bucket(zob)
+	replace, replaceScore := -1, 0
+	for i := range bucket {
+		key, entry := bucket[i].load()
+		if key == zob {
+			if entry.generation == table.generation && int(entry.depth) > depth && posType != hisExact {
+				if entry.move == MvNop && mv != MvNop {
+					entry.move = mv
+					bucket[i].store(zob, entry)
+				}
+				return
+			}
+			if mv == MvNop {
+				mv = entry.move
+			}
+			replace = i
+			break
+		}
+		if score := table.replaceScore(key, entry); replace < 0 || score < replaceScore {
+			replace, replaceScore = i, score
+		}
+	}
+	bucket[replace].store(zob, hashEntry{
+		move:       mv,
+		value:      int16(valueToHash(value, nDistance)),
+		depth:      int8(depth),
+		generation: table.generation,
+		posType:    posType,
+	})
+}
+
+// 替换优先级，越小越先被替换
+// 代数会回绕，空项的代数可能和当前相同，所以空项不按代数比较，总是最先被替换
+func (table *HashTable) replaceScore(key ZobristHash, entry hashEntry) int {
+	if key == 0 || entry.depth == 0 {
+		return math.MinInt32
+	}
+	age := int(table.generation - entry.generation)
+	return int(entry.depth) - age*8
+}
+
+// 杀棋分与距根节点的步数有关，存入置换表时换算成距当前局面的步数
+func valueToHash(vl int, nDistance int) int {
+	if vl > winValue {
+		return vl + nDistance
+	} else if vl < -winValue {
+		return vl - nDistance
+	}
+	return vl
+}
+
+func valueFromHash(vl int, nDistance int) int {
+	if vl > winValue {
+		return vl - nDistance
+	} else if vl < -winValue {
+		return vl + nDistance
+	}
+	return vl
+}
@@ -0,0 +1,60 @@
+package ppos
+
+import "testing"
+
+func TestHashMateValue(t *testing.T) {
+	table := CreateHashTable(1)
+	var zob ZobristHash = 0x1234
+	// 在距根节点3步的局面记录一个5步后的杀棋
+	table.record(zob, 4, mateValue-8, hisExact, GetMoveFromICCS("h2e2"), 3)
+	// 同一局面在距根节点5步时查到，杀棋步数应保持不变
+	hit, vl, mv := table.probe(zob, 4, -mateValue, mateValue, 5)
+	if !hit || vl != mateValue-10 {
+		t.Errorf("mate value not adjusted, hit: %v, vl: %v", hit, vl)
+	}
+	if mv.ICCS() != "h2e2" {
+		t.Errorf("best move lost: %v", mv)
+	}
+	hit, _, _ = table.probe(zob, 5, -mateValue, mateValue, 5)
+	if hit {
+		t.Errorf("shallow entry should not cut off")
+	}
+}
+
+func TestHashReplace(t *testing.T) {
+	table := CreateHashTable(1)
+	var zob ZobristHash = 0x10
+	// 同一个桶里记录超过桶容量的局面，最浅的项被替换
+	for i := 0; i <= bucketSize; i++ {
+		table.record(zob+ZobristHash(i)<<32, 10-i, 0, hisExact, MvNop, 0)
+	}
+	if hit, _, _ := table.probe(zob, 10, 0, 0, 0); !hit {
+		t.Errorf("deepest entry should be kept")
+	}
+	if hit, _, _ := table.probe(zob+ZobristHash(bucketSize-1)<<32, 0, 0, 0, 0); hit {
+		t.Errorf("shallowest entry should be replaced")
+	}
+	// 新的搜索中旧的项优先被替换
+	table.newSearch()
+	table.record(zob+0x100<<32, 1, 0, hisExact, MvNop, 0)
+	if hit, _, _ := table.probe(zob+0x100<<32, 1, 0, 0, 0); !hit {
+		t.Errorf("new entry should be recorded")
+	}
+}
+
+func TestHashReplaceEmptyAfterWrap(t *testing.T) {
+	table := CreateHashTable(1)
+	var zob ZobristHash = 0x10
+	table.generation = 0xff
+	for i := 0; i < bucketSize-1; i++ {
+		table.record(zob+ZobristHash(i)<<32, 1, 0, hisExact, MvNop, 0)
+	}
+	// 代数回绕到0后，空项看起来和当前代数相同，仍然要先用空项
+	table.newSearch()
+	table.record(zob+0x100<<32, 1, 0, hisExact, MvNop, 0)
+	for i := 0; i < bucketSize-1; i++ {
+		if hit, _, _ := table.probe(zob+ZobristHash(i)<<32, 1, 0, 0, 0); !hit {
+			t.Errorf("entry %d should not be replaced while an empty slot exists", i)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package ppos
+
+import "sort"
+
+// 着法选择的阶段
+const (
+	phaseHash = iota
+	phaseGenCaptures
+	phaseCaptures
+	phaseKiller1
+	phaseKiller2
+	phaseCounter
+	phaseGenQuiets
+	phaseQuiets
+	phaseBadCaptures
+	phaseDone
+)
+
+// 分阶段选择着法，前面阶段产生截断时就不用生成后面的着法了
+// 顺序：置换表着法，不亏子的吃子着法(MVV/LVA)，杀手着法，反击着法，其余着法(历史表)，亏子的吃子着法
+type movePicker struct {
+	pos   *Position
+	ctx   *searchCtx
+	phase int
+	// 置换表着法
+	mvHash Move
+	// 杀手着法
+	mvKillers [2]Move
+	// 反击着法
+	mvCounter Move
+	// 静态交换评估亏子的吃子着法，放到最后
+	badCaptures []Move
+	moves       []Move
+	idx         int
+}
+
+func (pos *Position) createMovePicker(ctx *searchCtx, mvHash Move) *movePicker {
+	picker := &movePicker{pos: pos, ctx: ctx, mvHash: mvHash}
+	if pos.ply() < len(ctx.killerMoves) {
+		picker.mvKillers = ctx.killerMoves[pos.ply()]
+	}
+	picker.mvCounter = ctx.counterMove(pos)
+	return picker
+}
+
+// 返回下一个着法，没有着法时返回MvNop，着法走后可能被将军
+func (picker *movePicker) next() Move {
+	pos := picker.pos
+	for {
+		switch picker.phase {
+		case phaseHash:
+			picker.phase = phaseGenCaptures
+			if picker.mvHash != MvNop && pos.pseudoLegalMove(picker.mvHash) {
+				return picker.mvHash
+			}
+			picker.mvHash = MvNop
+		case phaseGenCaptures:
+			picker.phase = phaseCaptures
+			picker.moves = pos.GenerateMoves(true)
+			picker.idx = 0
+			sort.Sort(MoveSorter{moves: picker.moves, eval: pos.mvvLvaValue})
+		case phaseCaptures:
+			for picker.idx < len(picker.moves) {
+				mv := picker.moves[picker.idx]
+				picker.idx++
+				if mv == picker.mvHash {
+					continue
+				}
+				if !pos.goodCapture(mv) {
+					picker.badCaptures = append(picker.badCaptures, mv)
+					continue
+				}
+				return mv
+			}
+			picker.phase = phaseKiller1
+		case phaseKiller1, phaseKiller2, phaseCounter:
+			var mv Move
+			if picker.phase == phaseCounter {
+				mv = picker.mvCounter
+			} else {
+				mv = picker.mvKillers[picker.phase-phaseKiller1]
+			}
+			picker.phase++
+			if picker.specialQuiet(mv) {
+				return mv
+			}
+		case phaseGenQuiets:
+			picker.phase = phaseQuiets
+			picker.moves = picker.moves[:0]
+			for _, mv := range pos.GenerateMoves(false) {
+				if pos.pcSquares[mv.Dst()] == PcNop {
+					picker.moves = append(picker.moves, mv)
+				}
+			}
+			picker.idx = 0
+			sort.Sort(MoveSorter{moves: picker.moves, eval: func(mv Move) int {
+				return picker.ctx.historyMoveTable[mv]
+			}})
+		case phaseQuiets:
+			for picker.idx < len(picker.moves) {
+				mv := picker.moves[picker.idx]
+				picker.idx++
+				if mv != picker.mvHash && mv != picker.mvKillers[0] && mv != picker.mvKillers[1] && mv != picker.mvCounter {
+					return mv
+				}
+			}
+			picker.phase = phaseBadCaptures
+			picker.idx = 0
+		case phaseBadCaptures:
+			if picker.idx < len(picker.badCaptures) {
+				picker.idx++
+				return picker.badCaptures[picker.idx-1]
+			}
+			picker.phase = phaseDone
+		default:
+			return MvNop
+		}
+	}
+}
+
+// 杀手着法和反击着法必须是可走的不吃子着法，并且没有在前面的阶段走过
+func (picker *movePicker) specialQuiet(mv Move) bool {
+	if mv == MvNop || mv == picker.mvHash {
+		return false
+	}
+	if picker.phase > phaseKiller2 && mv == picker.mvKillers[0] {
+		return false
+	}
+	if picker.phase > phaseCounter && mv == picker.mvKillers[1] {
+		return false
+	}
+	return picker.pos.pcSquares[mv.Dst()] == PcNop && picker.pos.pseudoLegalMove(mv)
+}
+
+// 对方上一步着法对应的反击着法
+func (ctx *searchCtx) counterMove(pos *Position) Move {
+	mvLast := pos.mvStack[pos.nDistance].move
+	if mvLast == MvNop {
+		return MvNop
+	}
+	return ctx.counterMoves[pos.pcSquares[mvLast.Dst()]][mvLast.Dst()]
+}
+
+// 不吃子的着法产生截断时，记录为杀手着法和反击着法
+func (ctx *searchCtx) recordQuietCutoff(pos *Position, mv Move) {
+	if pos.ply() < len(ctx.killerMoves) {
+		killers := &ctx.killerMoves[pos.ply()]
+		if killers[0] != mv {
+			killers[1] = killers[0]
+			killers[0] = mv
+		}
+	}
+	mvLast := pos.mvStack[pos.nDistance].move
+	if mvLast != MvNop {
+		ctx.counterMoves[pos.pcSquares[mvLast.Dst()]][mvLast.Dst()] = mv
+	}
+}
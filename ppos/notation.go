@@ -0,0 +1,246 @@
+package ppos
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// 着法的记法
+type Notation int8
+
+const (
+	// ICCS坐标记法，如h2e2
+	NotationICCS Notation = iota
+	// 中文纵线记法，如炮二平五
+	NotationChinese
+	// WXF记法，如C2.5
+	NotationWXF
+)
+
+func (notation Notation) String() string {
+	switch notation {
+	case NotationChinese:
+		return "chinese"
+	case NotationWXF:
+		return "wxf"
+	default:
+		return "iccs"
+	}
+}
+
+// 按名称取记法，空串为ICCS
+func ParseNotation(name string) (Notation, error) {
+	switch name {
+	case "", "iccs":
+		return NotationICCS, nil
+	case "chinese":
+		return NotationChinese, nil
+	case "wxf":
+		return NotationWXF, nil
+	default:
+		return NotationICCS, fmt.Errorf("unknown notation: %s", name)
+	}
+}
+
+// 用指定记法表示当前局面下的着法
+func (pos *Position) FormatMove(mv Move, notation Notation) string {
+	switch notation {
+	case NotationChinese:
+		return pos.MoveToChinese(mv)
+	case NotationWXF:
+		return pos.MoveToWXF(mv)
+	default:
+		return mv.ICCS()
+	}
+}
+
+// 按指定记法解析当前局面下的合法着法
+func (pos *Position) ParseMove(str string, notation Notation) (Move, error) {
+	switch notation {
+	case NotationChinese:
+		return pos.ParseChinese(str)
+	case NotationWXF:
+		return pos.ParseWXF(str)
+	default:
+		return pos.ParseICCS(str)
+	}
+}
+
+var iccsRegexp = regexp.MustCompile(`^[a-i]\d[a-i]\d$`)
+
+// 解析ICCS着法，着法必须合法
+func (pos *Position) ParseICCS(str string) (Move, error) {
+	if !iccsRegexp.MatchString(str) {
+		return MvNop, fmt.Errorf("illegal iccs move: %s", str)
+	}
+	mv := GetMoveFromICCS(str)
+	if !pos.LegalMove(mv) {
+		return MvNop, fmt.Errorf("illegal move: %s", str)
+	}
+	return mv, nil
+}
+
+// 从当前局面开始连续走mvs，用指定记法表示每一步，用于输出主要变例
+func (pos *Position) FormatMoves(mvs []Move, notation Notation) []string {
+	p := pos.clone()
+	moves := make([]string, 0, len(mvs))
+	for _, mv := range mvs {
+		moves = append(moves, p.FormatMove(mv, notation))
+		if !p.MakeMove(mv) {
+			break
+		}
+	}
+	return moves
+}
+
+// 用指定记法导出从起始局面到当前局面走过的着法
+func (pos *Position) ExportMoves(notation Notation) []string {
+	p := pos.clone()
+	mvs := make([]Move, 0, p.nDistance)
+	for p.nDistance > 0 {
+		mvs = append(mvs, p.mvStack[p.nDistance].move)
+		p.UndoMakeMove()
+	}
+	revertSlice(mvs)
+	return p.FormatMoves(mvs, notation)
+}
+
+// 纵线记谱的要素，中文记谱和WXF记谱只是写法不同
+type moveRecord struct {
+	pt PieceType
+	// 同一纵线上同类棋子的数量，以及从走棋方看由前往后的序号(从1开始)
+	count, order int
+	// 起点所在纵线，从走棋方的右手边数起1-9
+	file int
+	// 多条纵线上都有重叠的兵(卒)，前后之外还要写出纵线
+	tandemFiles bool
+	// '+'进 '-'退 '.'平
+	action byte
+	// 平移和斜走的棋子是终点纵线，直走的进退是步数
+	num int
+}
+
+// 走棋方看到的纵线号
+func sideFile(sq Square, sd Side) int {
+	if sd == SdRed {
+		return 9 - sq.GetX()
+	}
+	return sq.GetX() + 1
+}
+
+func (pos *Position) moveRecord(mv Move) moveRecord {
+	sqSrc, sqDst := mv.Src(), mv.Dst()
+	pc := pos.pcSquares[sqSrc]
+	sd := pc.GetSide()
+	rec := moveRecord{pt: pc.GetType(), file: sideFile(sqSrc, sd)}
+	forward := sqSrc.GetY() - sqDst.GetY()
+	if sd == SdBlack {
+		forward = -forward
+	}
+	switch {
+	case forward == 0:
+		rec.action, rec.num = '.', sideFile(sqDst, sd)
+	case forward > 0:
+		rec.action, rec.num = '+', forward
+	default:
+		rec.action, rec.num = '-', -forward
+	}
+	switch rec.pt {
+	case PtAdvisor, PtBishop, PtKnight:
+		rec.num = sideFile(sqDst, sd)
+	}
+	// 仕(士)相(象)在同一纵线时能进的在后、能退的在前，不用区分前后
+	switch rec.pt {
+	case PtKnight, PtRook, PtCannon, PtPawn:
+		rec.count, rec.order = pos.fileOrder(sqSrc)
+		if rec.pt == PtPawn && rec.count > 1 {
+			rec.tandemFiles = pos.tandemPawnFiles(sd) > 1
+		}
+	}
+	return rec
+}
+
+// sq上的棋子所在纵线上同类棋子的数量，以及它从前往后的序号
+func (pos *Position) fileOrder(sq Square) (int, int) {
+	pc := pos.pcSquares[sq]
+	count, order := 0, 1
+	for y := 0; y < 10; y++ {
+		if pos.pcSquares[GetSquare(sq.GetX(), y)] != pc {
+			continue
+		}
+		count++
+		if (pc.GetSide() == SdRed && y < sq.GetY()) || (pc.GetSide() == SdBlack && y > sq.GetY()) {
+			order++
+		}
+	}
+	return count, order
+}
+
+// sd方有多个兵(卒)的纵线数
+func (pos *Position) tandemPawnFiles(sd Side) int {
+	pawn := GetPiece(PtPawn, sd)
+	files := 0
+	for x := 0; x < 9; x++ {
+		count := 0
+		for y := 0; y < 10; y++ {
+			if pos.pcSquares[GetSquare(x, y)] == pawn {
+				count++
+			}
+		}
+		if count > 1 {
+			files++
+		}
+	}
+	return files
+}
+
+// 解析记谱得到的条件，没写出的要素为0(棋子为-1)
+type recordQuery struct {
+	pt PieceType
+	// 'f'前 'm'中 'r'后，'1'-'5'为从前往后的序号
+	order  byte
+	file   int
+	action byte
+	num    int
+}
+
+func (q recordQuery) match(rec moveRecord) bool {
+	if q.action != rec.action || q.num != rec.num {
+		return false
+	}
+	if (q.pt >= 0 && q.pt != rec.pt) || (q.file != 0 && q.file != rec.file) {
+		return false
+	}
+	switch {
+	case q.order == 0:
+		return true
+	case rec.count < 2:
+		return false
+	case q.order == 'f':
+		return rec.order == 1
+	case q.order == 'r':
+		return rec.order == rec.count
+	case q.order == 'm':
+		return rec.count == 3 && rec.order == 2
+	default:
+		return rec.order == int(q.order-'0')
+	}
+}
+
+// 找出符合条件的唯一合法着法
+func (pos *Position) findRecord(q recordQuery, str string) (Move, error) {
+	found := MvNop
+	for _, mv := range pos.legalMoves() {
+		if !q.match(pos.moveRecord(mv)) {
+			continue
+		}
+		if found != MvNop {
+			return MvNop, fmt.Errorf("ambiguous move: %s", str)
+		}
+		found = mv
+	}
+	if found == MvNop {
+		return MvNop, fmt.Errorf("illegal move: %s", str)
+	}
+	return found, nil
+}
@@ -0,0 +1,43 @@
+package ppos
+
+// 根节点一个着法下的叶子节点数
+type PerftResult struct {
+	Move  Move
+	Nodes int64
+}
+
+// 统计depth层合法着法树的叶子节点数，用于验证着法生成和走子的正确性
+func (pos *Position) Perft(depth int) int64 {
+	if depth <= 0 {
+		return 1
+	}
+	var nodes int64
+	for _, mv := range pos.GenerateMoves(false) {
+		if !pos.MakeMove(mv) {
+			continue
+		}
+		if depth == 1 {
+			nodes++
+		} else {
+			nodes += pos.Perft(depth - 1)
+		}
+		pos.UndoMakeMove()
+	}
+	return nodes
+}
+
+// 按根节点的着法分别统计叶子节点数，便于和其他引擎对比找出出错的着法
+func (pos *Position) Divide(depth int) []PerftResult {
+	var results []PerftResult
+	if depth <= 0 {
+		return results
+	}
+	for _, mv := range pos.GenerateMoves(false) {
+		if !pos.MakeMove(mv) {
+			continue
+		}
+		results = append(results, PerftResult{Move: mv, Nodes: pos.Perft(depth - 1)})
+		pos.UndoMakeMove()
+	}
+	return results
+}
@@ -0,0 +1,63 @@
+package ppos
+
+import "testing"
+
+// 各局面前几层的叶子节点数，与其他象棋引擎的结果一致
+var perftSuite = []struct {
+	fen   string
+	nodes []int64
+}{
+	{initFen, []int64{44, 1920, 79666, 3290240}},
+	// 炮架、马腿
+	{"r1ba1a3/4kn3/2n1b4/pNp1p1p1p/4c4/6P2/P1P2R2P/1CcC5/9/2BAKAB2 w - - 0 1", []int64{38, 1128, 43929, 1339047}},
+	{"1cbak4/9/n2a5/2p1p3p/5cp2/2n2N3/6PCP/3AB4/2C6/3A1K1N1 w - - 0 1", []int64{7, 281, 8620, 326201}},
+	// 将帅对面
+	{"5a3/3k5/3aR4/9/5r3/5n3/9/3A1A3/5K3/2BC2B2 w - - 0 1", []int64{25, 424, 9850, 202884}},
+	{"CRN1k1b2/3ca4/4ba3/9/2nr5/9/9/4B4/4A4/4KA3 w - - 0 1", []int64{28, 516, 14808, 395483}},
+	{"R1N1k1b2/9/3aba3/9/2nr5/2B6/9/4B4/4A4/4KA3 w - - 0 1", []int64{21, 364, 7626, 162837}},
+	{"C1nNk4/9/9/9/9/9/n1pp5/B3C4/9/3A1K3 w - - 0 1", []int64{28, 222, 6241, 64971}},
+	{"4ka3/4a4/9/9/4N4/p8/9/4C3c/7n1/2BK5 w - - 0 1", []int64{23, 345, 8124, 149272}},
+	{"2b1ka3/9/b3N4/4n4/9/9/9/4C4/2p6/2BK5 w - - 0 1", []int64{21, 195, 3883, 48060}},
+	{"1C2ka3/9/C1Nab1n2/p3p3p/6p2/9/P3P3P/3AB4/3p2c2/c1BAK4 w - - 0 1", []int64{30, 830, 22787, 649866}},
+	{"CnN1k1b2/c3a4/4ba3/9/2nr5/9/9/4C4/4A4/4KA3 w - - 0 1", []int64{19, 583, 11714, 376467}},
+}
+
+func TestPerft(t *testing.T) {
+	for _, test := range perftSuite {
+		pos, err := CreatePositionFromFenStr(test.fen)
+		if err != nil {
+			t.Fatalf("%s: %v", test.fen, err)
+		}
+		for i, expect := range test.nodes {
+			depth := i + 1
+			// 最深一层比较耗时
+			if testing.Short() && depth == len(test.nodes) {
+				break
+			}
+			if nodes := pos.Perft(depth); nodes != expect {
+				t.Errorf("%s depth %d: expect %d, got %d", test.fen, depth, expect, nodes)
+			}
+		}
+		if pos.FenString() != test.fen {
+			t.Errorf("position changed after perft: %s", pos.FenString())
+		}
+	}
+}
+
+func TestDivide(t *testing.T) {
+	pos, _ := CreatePositionFromFenStr(initFen)
+	results := pos.Divide(3)
+	if len(results) != 44 {
+		t.Fatalf("expect 44 moves, got %d", len(results))
+	}
+	var total int64
+	for _, result := range results {
+		total += result.Nodes
+		if result.Move == GetMoveFromICCS("h2e2") && result.Nodes != 1564 {
+			t.Errorf("h2e2: expect 1564, got %d", result.Nodes)
+		}
+	}
+	if total != 79666 {
+		t.Errorf("expect 79666, got %d", total)
+	}
+}
@@ -1,9 +1,13 @@
 package ppos
 
 import (
+	"context"
+	"fmt"
 	"github.com/sirupsen/logrus"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -16,8 +20,8 @@ const initMovesSize = 60
 // 杀棋分
 const mateValue = 10000
 
-// 和棋分
-const drawValue = -20
+// 默认的和棋藐视值，引擎一方把和棋当作落后这么多分
+const DefaultContempt = 20
 
 // 搜索出胜局的分数
 const winValue = mateValue - 100
@@ -25,44 +29,138 @@ const winValue = mateValue - 100
 // 先行优势
 const advancedValue = 3
 
-type searchCtx struct {
+// 多变例搜索最多的变例数
+const MaxMultiPV = 16
+
+// 搜索参数，限制条件为0时表示不做限制
+type SearchParams struct {
+	// 最长思考时间
+	Duration time.Duration
+	// 最大搜索深度
+	Depth int
+	// 最大搜索局面数
+	Nodes int
+	// 和棋藐视值
+	Contempt int
+	// 置换表，为空时每次搜索新建一个
+	HashTable *HashTable
+	// 后期着法减少深度表，为空时使用默认参数
+	Reductions *ReductionTable
+	// 搜索线程数，多于1个时启动辅助线程共享置换表一起搜索
+	Threads int
+	// 搜索的变例数，多于1个时根节点分别给出最好的几个着法，不应超过MaxMultiPV
+	MultiPV int
+	// 根节点禁止走的着法
+	BanMoves []Move
+	// 根节点只搜索这些着法，为空时搜索全部着法
+	SearchMoves []Move
+	// 每完成一层迭代时的回调
+	OnIteration func(info SearchInfo)
+	// 根节点开始搜索某个着法时的回调，number从1开始
+	OnCurrMove func(mv Move, number int)
+}
+
+// 评价值的性质
+type ScoreBound int8
+
+const (
+	BoundExact ScoreBound = iota
+	// 高出窗口，实际值不低于Score
+	BoundLower
+	// 低于窗口，实际值不高于Score
+	BoundUpper
+)
+
+// 搜索过程信息
+type SearchInfo struct {
+	Depth int
+	Score int
+	Bound ScoreBound
+	// 已用时间
+	Time time.Duration
 	// 已搜索的局面数
-	nPositionCount int
+	Nodes int
+	// 主要变例
+	PV []Move
+	// 多变例搜索时是第几条变例，从1开始，单变例搜索时为0
+	MultiPV int
+}
+
+// 多变例搜索中的一条变例
+type PVLine struct {
+	Score int
+	PV    []Move
+}
+
+// 搜索开始后超过该时间才回调根节点当前着法，避免刷屏
+const currMoveInterval = time.Second
+
+type searchCtx struct {
+	// 已搜索的局面数，主线程汇总时会并发读取
+	nPositionCount int64
 	// 停止搜索的时间
 	stopSearchTime time.Time
+	// 最大搜索局面数
+	maxPositionCount int
+	// 开始搜索的时间
+	startTime time.Time
+	// 根节点当前着法回调
+	onCurrMove func(mv Move, number int)
+	// 根节点的走棋方
+	rootSd Side
+	// 和棋藐视值
+	contempt int
+	// 外部取消搜索的信号
+	done <-chan struct{}
 	// 停止搜索
 	stopSearch bool
 	// 历史表
 	historyMoveTable [65536]int
-	// hash表
-	historyPosTable [65536]historyPosition
+	// 每一层的杀手着法
+	killerMoves [limitDepth + 1][2]Move
+	// 反击着法表，按对方上一步走的棋子和目标格索引
+	counterMoves [24][256]Move
+	// 置换表
+	hashTable *HashTable
+	// 后期着法减少深度表
+	reductions *ReductionTable
+	// 主线程上记录的辅助线程
+	helpers []*searchCtx
+	// 根节点禁止走的着法以及不在搜索范围内的着法
+	rootBanned []Move
+	// 根节点排除的着法，包括禁止走的着法和多变例搜索中前面变例的着法
+	rootExcluded []Move
 }
 
-const hashIdxMask = 0xffff
-
-func (ctx *searchCtx) probeHash(zob ZobristHash, depth int, alpha int, beta int) (bool, int) {
-	hisPosition := &ctx.historyPosTable[zob&hashIdxMask]
-	if hisPosition.zobrist != zob || hisPosition.depth < depth {
-		return false, 0
+// 辅助线程的搜索状态，共享置换表等只读数据，历史表等各自独立
+func (ctx *searchCtx) createHelper(done <-chan struct{}) *searchCtx {
+	return &searchCtx{
+		done:       done,
+		startTime:  ctx.startTime,
+		rootSd:     ctx.rootSd,
+		contempt:   ctx.contempt,
+		hashTable:  ctx.hashTable,
+		reductions: ctx.reductions,
+		// 辅助线程也不搜索禁止的着法，但不排除多变例搜索中已经搜过的着法
+		rootExcluded: ctx.rootBanned,
 	}
-	if hisPosition.posType == hisExact {
-		return true, hisPosition.value
-	} else if hisPosition.posType == hisAlpha && hisPosition.value <= alpha {
-		return true, alpha
-	} else if hisPosition.posType == hisBeta && hisPosition.value >= beta {
-		return true, beta
+}
+
+// 所有线程搜索的局面数
+func (ctx *searchCtx) nodes() int {
+	nodes := atomic.LoadInt64(&ctx.nPositionCount)
+	for _, helper := range ctx.helpers {
+		nodes += atomic.LoadInt64(&helper.nPositionCount)
 	}
-	return false, 0
+	return int(nodes)
 }
-func (ctx *searchCtx) recordHash(zob ZobristHash, depth int, value int, posType historyType) {
-	hisPosition := &ctx.historyPosTable[zob&hashIdxMask]
-	if hisPosition.zobrist == zob && hisPosition.depth > depth {
-		return
+
+// 和棋对当前走棋方的评分
+func (ctx *searchCtx) drawValue(pos *Position) int {
+	if pos.playerSd == ctx.rootSd {
+		return -ctx.contempt
 	}
-	hisPosition.zobrist = zob
-	hisPosition.depth = depth
-	hisPosition.posType = posType
-	hisPosition.value = value
+	return ctx.contempt
 }
 
 type historyMove struct {
@@ -70,20 +168,8 @@ type historyMove struct {
 	pcCaptured Piece
 	checked    bool
 	posZobrist ZobristHash
-}
-type historyType uint8
-
-const (
-	hisExact historyType = iota
-	hisAlpha
-	hisBeta
-)
-
-type historyPosition struct {
-	zobrist ZobristHash
-	depth   int
-	posType historyType
-	value   int
+	// 走棋前的未吃子步数
+	noCapture int
 }
 type Position struct {
 	// 棋盘
@@ -94,12 +180,27 @@ type Position struct {
 	vlRed int
 	// 黑旗分
 	vlBlack int
+	// 双方除兵(卒)以外的子力，用于判断能否走空着
+	vlNonPawn [3]int
+	// 双方能过河进攻的棋子(车马炮兵)数，用于判断子力不足的和棋
+	nAttackers [3]int
+	// 未吃子的半回合数
+	noCapture int
+	// 回合数，从1开始，黑方走后加1
+	fullMove int
 	// 局面zobrist
 	zobrist ZobristHash
 	// 走棋栈，可从中找到是否有重复局面
 	mvStack []historyMove
-	// 距离根节点的步数
+	// 走棋栈中的步数
 	nDistance int
+	// 搜索根节点在走棋栈中的位置，根节点之前的着法只用来判断重复局面
+	nRoot int
+}
+
+// 距离搜索根节点的步数
+func (pos *Position) ply() int {
+	return pos.nDistance - pos.nRoot
 }
 
 func (pos *Position) ChangeSide() {
@@ -113,6 +214,8 @@ func (pos *Position) AddPiece(sq Square, pc Piece) {
 	}
 	side := pc.GetSide()
 	pcValue := pieceValue[pc.GetType()]
+	pos.vlNonPawn[side] += nonPawnValue[pc.GetType()]
+	pos.nAttackers[side] += attackerCount[pc.GetType()]
 	if side == SdRed {
 		pos.vlRed += pcValue[sq]
 	} else {
@@ -128,6 +231,8 @@ func (pos *Position) DelPiece(sq Square) Piece {
 	pos.pcSquares[sq] = PcNop
 	side := pcCaptured.GetSide()
 	pcValueTable := pieceValue[pcCaptured.GetType()]
+	pos.vlNonPawn[side] -= nonPawnValue[pcCaptured.GetType()]
+	pos.nAttackers[side] -= attackerCount[pcCaptured.GetType()]
 	if side == SdRed {
 		pos.vlRed -= pcValueTable[sq]
 	} else {
@@ -349,58 +454,189 @@ func (pos *Position) MakeMove(move Move) bool {
 		return false
 	}
 	pos.ChangeSide()
-	pos.mvStack = append(pos.mvStack, historyMove{move, pcCaptured, pos.Checked(), preZob})
+	pos.mvStack = append(pos.mvStack, historyMove{move, pcCaptured, pos.Checked(), preZob, pos.noCapture})
 	pos.nDistance++
+	if pcCaptured != PcNop {
+		pos.noCapture = 0
+	} else {
+		pos.noCapture++
+	}
+	if pos.playerSd == SdRed {
+		pos.fullMove++
+	}
 	return true
 }
 
+// 走空着，只交换走棋方
+func (pos *Position) MakeNullMove() {
+	preZob := pos.zobrist
+	pos.ChangeSide()
+	pos.mvStack = append(pos.mvStack, historyMove{MvNop, PcNop, false, preZob, pos.noCapture})
+	pos.nDistance++
+}
+
+func (pos *Position) UndoNullMove() {
+	pos.ChangeSide()
+	pos.nDistance--
+	pos.mvStack = pos.mvStack[:pos.nDistance+1]
+}
+
+// 子力太少时走空着容易误判(等着的局面很常见)
+func (pos *Position) nullOkay() bool {
+	return pos.vlNonPawn[pos.playerSd] > nullOkayMargin
+}
+
+// 子力足够多时空着裁剪不需要检验
+func (pos *Position) nullSafe() bool {
+	return pos.vlNonPawn[pos.playerSd] > nullSafeMargin
+}
+
 func (pos *Position) UndoMakeMove() {
+	if pos.playerSd == SdRed {
+		pos.fullMove--
+	}
 	pos.ChangeSide()
 	moveHis := pos.mvStack[pos.nDistance]
 	pos.UndoMovePiece(moveHis.move, moveHis.pcCaptured)
+	pos.noCapture = moveHis.noCapture
 	pos.nDistance--
 	pos.mvStack = pos.mvStack[:pos.nDistance+1]
 }
 
 // return 评价值，主要变例(逆序）
-func (pos *Position) searchAlphaBeta(ctx *searchCtx, vlAlpha, vlBeta, depth int) (int, []Move) {
+// noNull 不允许走空着，用于空着之后及检验搜索
+func (pos *Position) searchAlphaBeta(ctx *searchCtx, vlAlpha, vlBeta, depth int, noNull bool) (int, []Move) {
 	tickSearch(ctx)
-	success, vl := ctx.probeHash(pos.zobrist, depth, vlAlpha, vlBeta)
-	if success {
+	// 主要变例上(包括根节点)需要返回完整的变例，并且避免置换表中的边界值导致的误判，只在零窗口节点截断
+	success, vl, mvHash := ctx.hashTable.probe(pos.zobrist, depth, vlAlpha, vlBeta, pos.ply())
+	if success && vlBeta-vlAlpha == 1 {
 		return vl, nil
 	}
-	if pos.nDistance > 0 {
+	if pos.ply() > 0 {
 		// 1. 到达水平线，使用静态局面搜索
 		if depth <= 0 {
 			return pos.searchQuiescent(ctx, vlAlpha, vlBeta)
 		}
 
 		// 1-1. 检查重复局面
-		rep, vl := pos.CheckReputation(1)
+		rep, vl := pos.checkReputation(1, ctx.drawValue(pos))
 		if rep {
 			return vl, nil
 		}
 
-		// 1-2. 到达极限深度就返回局面评价
-		if pos.nDistance == limitDepth {
+		// 1-2. 自然限着或子力不足判和，被将军时先看是否被将死
+		if pos.drawn() && !pos.InCheck() {
+			return ctx.drawValue(pos), nil
+		}
+
+		// 1-3. 到达极限深度就返回局面评价
+		if pos.ply() == limitDepth {
 			return pos.Evaluate(), nil
 		}
+
+		// 1-4. 静态空着裁剪(反向无望裁剪)，局面评价减去余量仍不低于beta就直接截断
+		if vlBeta-vlAlpha == 1 && !pos.InCheck() && depth <= reverseFutilityDepth && vlBeta < winValue && vlBeta > -winValue {
+			if vl := pos.Evaluate() - reverseFutilityMargin*depth; vl >= vlBeta {
+				return vl, nil
+			}
+		}
+
+		// 1-5. 剃刀裁剪，局面评价加上余量仍低于alpha时用静态搜索确认
+		if vlBeta-vlAlpha == 1 && !pos.InCheck() && depth <= razorDepth && vlAlpha < winValue && vlAlpha > -winValue &&
+			pos.Evaluate()+razorMargin[depth] < vlAlpha {
+			vl, _ := pos.searchQuiescent(ctx, vlAlpha, vlBeta)
+			if vl <= vlAlpha || ctx.stopSearch {
+				return vl, nil
+			}
+		}
+
+		// 1-6. 空着裁剪，让对方连走两步仍然不能低于beta就直接截断，主要变例上不做
+		if !noNull && vlBeta-vlAlpha == 1 && !pos.InCheck() && pos.nullOkay() && depth > nullReduction && pos.Evaluate() >= vlBeta {
+			pos.MakeNullMove()
+			vl, _ := pos.searchAlphaBeta(ctx, -vlBeta, 1-vlBeta, depth-1-nullReduction, true)
+			vl = -vl
+			pos.UndoNullMove()
+			if ctx.stopSearch {
+				return 0, nil
+			}
+			if vl >= vlBeta {
+				// 子力较少时用不走空着的浅层搜索检验一下，避免等着局面误判
+				if pos.nullSafe() {
+					return vlBeta, nil
+				}
+				vl, _ = pos.searchAlphaBeta(ctx, vlBeta-1, vlBeta, depth-nullReduction, true)
+				if ctx.stopSearch {
+					return 0, nil
+				}
+				if vl >= vlBeta {
+					return vlBeta, nil
+				}
+			}
+		}
 	}
 
-	moves := make([]Move, 0, initMovesSize)
 	vlBest := -mateValue
 	var pvMovesBest []Move
 	var mvBest = MvNop
-	moves = pos.GenerateMoves(false)
-	sort.Sort(MoveSorter{moves: moves, eval: func(mv Move) int {
-		return ctx.historyMoveTable[mv]
-	}})
-	for _, mv := range moves {
+	// 2. 分阶段选择着法，置换表着法产生截断时就不用生成其余着法了
+	picker := pos.createMovePicker(ctx, mvHash)
+	inCheck := pos.InCheck()
+	// 前沿节点局面评价加上余量仍不能超过alpha时，不将军的普通着法不用搜索
+	futility := false
+	vlFutility := 0
+	if pos.ply() > 0 && vlBeta-vlAlpha == 1 && !inCheck && depth <= futilityDepth && vlAlpha < winValue && vlAlpha > -winValue {
+		vlFutility = pos.Evaluate() + futilityMargin[depth]
+		futility = vlFutility < vlAlpha
+	}
+	nLegalMoves := 0
+	for mv := picker.next(); mv != MvNop; mv = picker.next() {
+		if pos.ply() == 0 && containsMove(ctx.rootExcluded, mv) {
+			continue
+		}
 		if !pos.MakeMove(mv) {
 			continue
 		}
-		vl, pvMoves := pos.searchAlphaBeta(ctx, -vlBeta, -vlAlpha, depth-1)
-		vl = -vl
+		nLegalMoves++
+		if pos.ply() == 1 && ctx.onCurrMove != nil && time.Since(ctx.startTime) > currMoveInterval {
+			ctx.onCurrMove(mv, nLegalMoves)
+		}
+		givesCheck := pos.InCheck()
+		// 3. 无望裁剪，至少搜索一个着法
+		if futility && nLegalMoves > 1 && !givesCheck && picker.phase == phaseQuiets {
+			pos.UndoMakeMove()
+			if vlFutility > vlBest {
+				vlBest = vlFutility
+			}
+			continue
+		}
+		// 4. 将军延伸，将军的着法多搜索一层
+		newDepth := depth - 1
+		if givesCheck {
+			newDepth++
+		}
+		// 5. 主要变例搜索，第一个着法用完整窗口，其余着法先用零窗口试探，高出alpha时再用完整窗口重新搜索
+		var vl int
+		var pvMoves []Move
+		if nLegalMoves == 1 {
+			vl, pvMoves = pos.searchAlphaBeta(ctx, -vlBeta, -vlAlpha, newDepth, false)
+			vl = -vl
+		} else {
+			// 6. 排在后面的普通着法减少深度试探，高出alpha时再按正常深度搜索
+			reduction := 0
+			if depth >= lmrMinDepth && !inCheck && !givesCheck && picker.phase == phaseQuiets {
+				reduction = ctx.reductions.get(depth, nLegalMoves)
+			}
+			vl, _ = pos.searchAlphaBeta(ctx, -vlAlpha-1, -vlAlpha, newDepth-reduction, false)
+			vl = -vl
+			if reduction > 0 && vl > vlAlpha && !ctx.stopSearch {
+				vl, _ = pos.searchAlphaBeta(ctx, -vlAlpha-1, -vlAlpha, newDepth, false)
+				vl = -vl
+			}
+			if vl > vlAlpha && vl < vlBeta && !ctx.stopSearch {
+				vl, pvMoves = pos.searchAlphaBeta(ctx, -vlBeta, -vlAlpha, newDepth, false)
+				vl = -vl
+			}
+		}
 		pos.UndoMakeMove()
 		if ctx.stopSearch {
 			return 0, nil
@@ -420,40 +656,63 @@ func (pos *Position) searchAlphaBeta(ctx *searchCtx, vlAlpha, vlBeta, depth int)
 	}
 	// 所有的move都无法走 杀棋!
 	if vlBest == -mateValue {
-		return pos.nDistance - mateValue, nil
+		return pos.ply() - mateValue, nil
 	}
 	if mvBest != MvNop {
 		ctx.historyMoveTable[mvBest] += depth * depth
+		if vlBest >= vlBeta && pos.pcSquares[mvBest.Dst()] == PcNop {
+			ctx.recordQuietCutoff(pos, mvBest)
+		}
 	}
 	if vlBest != vlAlpha {
 		if vlBest >= vlBeta {
-			ctx.recordHash(pos.zobrist, depth, vlBest, hisBeta)
+			ctx.hashTable.record(pos.zobrist, depth, vlBest, hisBeta, mvBest, pos.ply())
 		} else {
-			ctx.recordHash(pos.zobrist, depth, vlBest, hisAlpha)
+			ctx.hashTable.record(pos.zobrist, depth, vlBest, hisAlpha, mvBest, pos.ply())
 		}
 		return vlBest, nil
 	} else {
-		ctx.recordHash(pos.zobrist, depth, vlBest, hisExact)
+		ctx.hashTable.record(pos.zobrist, depth, vlBest, hisExact, mvBest, pos.ply())
 		return vlBest, pvMovesBest
 	}
 }
 
 // 搜索中的状态检查
 func tickSearch(searchCtx *searchCtx) {
-	searchCtx.nPositionCount++
-	if searchCtx.nPositionCount&0x1fff == 0 && time.Now().After(searchCtx.stopSearchTime) {
+	nPositionCount := atomic.AddInt64(&searchCtx.nPositionCount, 1)
+	// 局面数限制的是所有线程的总数，只在主线程上检查，主线程结束后辅助线程随之停止
+	if searchCtx.maxPositionCount > 0 {
+		nodes := nPositionCount
+		if len(searchCtx.helpers) > 0 {
+			nodes = int64(searchCtx.nodes())
+		}
+		if nodes >= int64(searchCtx.maxPositionCount) {
+			searchCtx.stopSearch = true
+		}
+	}
+	if nPositionCount&0x3ff == 0 {
+		select {
+		case <-searchCtx.done:
+			searchCtx.stopSearch = true
+		default:
+		}
+	}
+	if nPositionCount&0x1fff == 0 && !searchCtx.stopSearchTime.IsZero() && time.Now().After(searchCtx.stopSearchTime) {
 		searchCtx.stopSearch = true
 	}
 }
 func (pos *Position) searchQuiescent(ctx *searchCtx, vlAlpha, vlBeta int) (int, []Move) {
 	// 1. 检查重复局面
-	rep, vl := pos.CheckReputation(1)
+	rep, vl := pos.checkReputation(1, ctx.drawValue(pos))
 	if rep {
 		return vl, nil
 	}
 
-	// 2. 到达极限深度就返回局面评价
-	if pos.nDistance == limitDepth {
+	// 2. 自然限着或子力不足判和，到达极限深度就返回局面评价
+	if pos.drawn() && !pos.InCheck() {
+		return ctx.drawValue(pos), nil
+	}
+	if pos.ply() == limitDepth {
 		return pos.Evaluate(), nil
 	}
 
@@ -488,8 +747,12 @@ func (pos *Position) searchQuiescent(ctx *searchCtx, vlAlpha, vlBeta int) (int,
 		}})
 	}
 
-	// 7. 逐一走这些走法，并进行递归
+	// 7. 逐一走这些走法，并进行递归，没被将军时跳过亏子的吃子着法
+	inCheck := pos.InCheck()
 	for _, mv := range moves {
+		if !inCheck && !pos.goodCapture(mv) {
+			continue
+		}
 		if !pos.MakeMove(mv) {
 			continue
 		}
@@ -510,7 +773,7 @@ func (pos *Position) searchQuiescent(ctx *searchCtx, vlAlpha, vlBeta int) (int,
 	}
 
 	if vlBest == -mateValue {
-		return pos.nDistance - mateValue, nil
+		return pos.ply() - mateValue, nil
 	} else if vlBest != vlAlpha {
 		return vlBest, nil
 	} else {
@@ -530,89 +793,320 @@ func (pos *Position) InCheck() bool {
 	}
 }
 
-// 检查重复局面
-// return 是否有重复局面， 重复局面的评分（输，赢，和）
-func (pos *Position) CheckReputation(n int) (bool, int) {
-	selfSide := false
-	selfAlwaysCheck, opAlwaysCheck := true, true
-	for mvIdx := pos.nDistance; mvIdx > 0; mvIdx-- {
-		moveHistory := pos.mvStack[mvIdx]
-		// 吃子着法肯定不会重复
-		if moveHistory.pcCaptured != PcNop {
-			break
-		}
-		if selfSide {
-			selfAlwaysCheck = selfAlwaysCheck && moveHistory.checked
-			if moveHistory.posZobrist == pos.zobrist {
-				n--
-				if n == 0 {
-					return true, reputationValue(selfAlwaysCheck, opAlwaysCheck)
-				}
-			}
-		} else {
-			opAlwaysCheck = opAlwaysCheck && moveHistory.checked
+// 当前走棋方的全部合法着法
+func (pos *Position) legalMoves() []Move {
+	var moves []Move
+	for _, mv := range pos.GenerateMoves(false) {
+		pcCaptured := pos.MovePiece(mv)
+		if !pos.Checked() {
+			moves = append(moves, mv)
 		}
-		selfSide = !selfSide
+		pos.UndoMovePiece(mv, pcCaptured)
 	}
-	return false, 0
+	return moves
 }
 
+// 着法是否合法，不改变局面
 func (pos *Position) LegalMove(move Move) bool {
 	for _, mv := range pos.GenerateMoves(false) {
 		if mv == move {
-			pos.MovePiece(mv)
-			return !pos.Checked()
+			pcCaptured := pos.MovePiece(mv)
+			legal := !pos.Checked()
+			pos.UndoMovePiece(mv, pcCaptured)
+			return legal
 		}
 	}
 	return false
 }
 
-func reputationValue(selfAlwaysCheck, opAlwaysCheck bool) int {
-	vl := 0
-	if selfAlwaysCheck {
-		vl += -mateValue
-	}
-	if opAlwaysCheck {
-		vl += mateValue
-	}
-	if vl == 0 {
-		vl = -drawValue
+func (pos *Position) SearchMain(duration time.Duration) ([]Move, int) {
+	return pos.Search(context.Background(), SearchParams{Duration: duration, Contempt: DefaultContempt})
+}
+
+// 按限制条件进行迭代加深搜索，c被取消时立即停止并返回最后一次完成的迭代结果
+// return 主要变例，评价值
+func (pos *Position) Search(c context.Context, params SearchParams) ([]Move, int) {
+	lines := pos.SearchMultiPV(c, params)
+	if len(lines) == 0 {
+		return nil, 0
 	}
-	return vl
+	return lines[0].PV, lines[0].Score
 }
-func (pos *Position) SearchMain(duration time.Duration) ([]Move, int) {
-	rep, score := pos.CheckReputation(3)
+
+// 多主要变例搜索，按评价值从高到低返回最多params.MultiPV个根节点着法各自的变例
+func (pos *Position) SearchMultiPV(c context.Context, params SearchParams) []PVLine {
+	rep, score := pos.checkReputation(repetitionLimit, -params.Contempt)
 	if rep {
-		return nil, score
+		return []PVLine{{Score: score}}
 	}
-	cleanPos, _ := CreatePositionFromFenStr(pos.FenString())
+	// 在副本上搜索，保留根节点之前的着法，跨过根节点的循环也能判断长将长捉
+	root := pos.clone()
+	root.nRoot = root.nDistance
 	startTime := time.Now()
 	effectiveEndTime := time.Now()
-	ctx := &searchCtx{}
-	ctx.stopSearchTime = time.Now().Add(duration)
-	var resValue int
-	var resPvMove []Move
+	ctx := &searchCtx{done: c.Done(), startTime: startTime, onCurrMove: params.OnCurrMove}
+	ctx.rootSd = root.playerSd
+	ctx.contempt = params.Contempt
+	ctx.hashTable = params.HashTable
+	if ctx.hashTable == nil {
+		ctx.hashTable = CreateHashTable(DefaultHashSizeMB)
+	}
+	ctx.hashTable.newSearch()
+	ctx.reductions = params.Reductions
+	if ctx.reductions == nil {
+		ctx.reductions = defaultReductions
+	}
+	if params.Duration > 0 {
+		ctx.stopSearchTime = startTime.Add(params.Duration)
+	}
+	ctx.maxPositionCount = params.Nodes
+	depthLimit := limitDepth
+	if params.Depth > 0 && params.Depth < limitDepth {
+		depthLimit = params.Depth
+	}
+	// 过滤根节点的着法，变例数不超过可走的着法数
+	nRootMoves := 0
+	for _, mv := range root.legalMoves() {
+		if containsMove(params.BanMoves, mv) || (len(params.SearchMoves) > 0 && !containsMove(params.SearchMoves, mv)) {
+			ctx.rootBanned = append(ctx.rootBanned, mv)
+		} else {
+			nRootMoves++
+		}
+	}
+	if nRootMoves == 0 {
+		return []PVLine{{Score: -mateValue}}
+	}
+	multiPV := params.MultiPV
+	if multiPV < 1 {
+		multiPV = 1
+	}
+	if multiPV > nRootMoves {
+		multiPV = nRootMoves
+	}
+	// 辅助线程各自用一份局面搜索，主线程结束时停止
+	helperCtx, stopHelpers := context.WithCancel(c)
+	var wg sync.WaitGroup
+	for i := 1; i < params.Threads; i++ {
+		helper := ctx.createHelper(helperCtx.Done())
+		ctx.helpers = append(ctx.helpers, helper)
+		wg.Add(1)
+		go func(helperPos *Position, id int) {
+			defer wg.Done()
+			helperPos.searchHelper(helper, id)
+		}(root.clone(), i)
+	}
+	var resLines []PVLine
 	nPositions := 0
-	maxDepth := 0
-	for ; maxDepth < limitDepth; maxDepth++ {
-		ctx.nPositionCount = 0
-		value, pvMoves := cleanPos.searchAlphaBeta(ctx, -mateValue, mateValue, maxDepth)
+	depth := 0
+	for depth < depthLimit {
+		// 每条变例都排除前面变例的第一个着法后重新搜索根节点，超出渴望窗口时按搜索顺序报告
+		lines := make([]PVLine, 0, multiPV)
+		ctx.rootExcluded = append(ctx.rootExcluded[:0], ctx.rootBanned...)
+		for i := 0; i < multiPV; i++ {
+			vlLast := 0
+			if i < len(resLines) {
+				vlLast = resLines[i].Score
+			}
+			onIteration := params.OnIteration
+			if onIteration != nil && params.MultiPV > 1 {
+				multiPVIdx := i + 1
+				onIteration = func(info SearchInfo) {
+					info.MultiPV = multiPVIdx
+					params.OnIteration(info)
+				}
+			}
+			value, pvMoves := root.searchAspiration(ctx, depth+1, vlLast, onIteration)
+			if ctx.stopSearch {
+				break
+			}
+			revertSlice(pvMoves)
+			pvMoves = root.extendPV(ctx.hashTable, pvMoves)
+			if len(pvMoves) == 0 || containsMove(ctx.rootExcluded, pvMoves[0]) {
+				break
+			}
+			lines = append(lines, PVLine{Score: value, PV: pvMoves})
+			ctx.rootExcluded = append(ctx.rootExcluded, pvMoves[0])
+		}
 		if ctx.stopSearch {
-			maxDepth--
 			break
 		}
-		resValue = value
-		resPvMove = pvMoves
-		nPositions = ctx.nPositionCount
+		depth++
+		sort.SliceStable(lines, func(i, j int) bool {
+			return lines[i].Score > lines[j].Score
+		})
+		resLines = lines
+		nPositions = ctx.nodes()
 		effectiveEndTime = time.Now()
-		if resValue > winValue || resValue < -winValue {
+		if params.OnIteration != nil {
+			for i, line := range resLines {
+				info := SearchInfo{Depth: depth, Score: line.Score, Time: effectiveEndTime.Sub(startTime), Nodes: nPositions, PV: line.PV}
+				if params.MultiPV > 1 {
+					info.MultiPV = i + 1
+				}
+				params.OnIteration(info)
+			}
+		}
+		if len(resLines) == 0 || resLines[0].Score > winValue || resLines[0].Score < -winValue {
+			break
+		}
+		// 已用去一半以上的时间，下一层搜索多半完不成
+		if params.Duration > 0 && effectiveEndTime.Sub(startTime) > params.Duration/2 {
+			break
+		}
+	}
+	stopHelpers()
+	wg.Wait()
+	logrus.Infof("search depth: %d, search nodes: %d, search time: %v, effect time:%v, lines: %v", depth, nPositions, time.Now().Sub(startTime), effectiveEndTime.Sub(startTime), resLines)
+	return resLines
+}
+
+// 辅助线程的迭代加深，结果只通过置换表影响主线程
+// 一半的辅助线程从第2层开始，与主线程错开搜索深度
+func (pos *Position) searchHelper(ctx *searchCtx, id int) {
+	vlLast := 0
+	for depth := 1 + id%2; depth <= limitDepth && !ctx.stopSearch; depth++ {
+		vlLast, _ = pos.searchAspiration(ctx, depth, vlLast, nil)
+	}
+}
+
+// 以上一层迭代的评价值为中心用较小的窗口搜索，超出窗口时加宽重新搜索
+// 超出窗口时通过onIteration报告上下界
+func (pos *Position) searchAspiration(ctx *searchCtx, depth int, vlLast int, onIteration func(info SearchInfo)) (int, []Move) {
+	vlAlpha, vlBeta := -mateValue, mateValue
+	delta := aspirationWindow
+	if depth > aspirationMinDepth && vlLast < winValue && vlLast > -winValue {
+		vlAlpha, vlBeta = vlLast-delta, vlLast+delta
+	}
+	for {
+		vl, pvMoves := pos.searchAlphaBeta(ctx, vlAlpha, vlBeta, depth, false)
+		if ctx.stopSearch {
+			return vl, pvMoves
+		}
+		var bound ScoreBound
+		if vl <= vlAlpha && vlAlpha > -mateValue {
+			bound = BoundUpper
+			vlAlpha = vl - delta
+		} else if vl >= vlBeta && vlBeta < mateValue {
+			bound = BoundLower
+			vlBeta = vl + delta
+		} else {
+			return vl, pvMoves
+		}
+		// 连续超出窗口时放开窗口
+		if vlAlpha < -winValue || delta > aspirationWindow {
+			vlAlpha = -mateValue
+		}
+		if vlBeta > winValue || delta > aspirationWindow {
+			vlBeta = mateValue
+		}
+		if onIteration != nil {
+			revertSlice(pvMoves)
+			onIteration(SearchInfo{Depth: depth, Score: vl, Bound: bound, Time: time.Since(ctx.startTime), Nodes: ctx.nodes(), PV: pvMoves})
+		}
+		delta *= 2
+	}
+}
+
+// 主要变例被置换表截断时，沿置换表中的最佳着法补全
+func (pos *Position) extendPV(table *HashTable, pv []Move) []Move {
+	nMoves := 0
+	defer func() {
+		for ; nMoves > 0; nMoves-- {
+			pos.UndoMakeMove()
+		}
+	}()
+	for _, mv := range pv {
+		if !pos.MakeMove(mv) {
+			return pv
+		}
+		nMoves++
+	}
+	for pos.ply() < limitDepth {
+		mv := table.bestMove(pos.zobrist)
+		if mv == MvNop || !pos.pseudoLegalMove(mv) || !pos.MakeMove(mv) {
+			break
+		}
+		nMoves++
+		pv = append(pv, mv)
+		if rep, _ := pos.CheckReputation(1); rep {
 			break
 		}
 	}
-	revertSlice(resPvMove)
-	logrus.Infof("search depth: %d, search nodes: %d, search time: %v, effect time:%v, score:%v, pv moves: %v", maxDepth, nPositions, time.Now().Sub(startTime), effectiveEndTime.Sub(startTime), resValue, resPvMove)
-	return resPvMove, resValue
+	return pv
+}
+
+// 着法是否符合走子规则，不检查走后是否被将军
+// 用于校验置换表等处得到的着法，不必生成全部着法
+func (pos *Position) pseudoLegalMove(mv Move) bool {
+	sqSrc, sqDst := mv.Src(), mv.Dst()
+	if !sqSrc.InBoard() || !sqDst.InBoard() {
+		return false
+	}
+	pcSrc := pos.pcSquares[sqSrc]
+	if pcSrc.GetSide() != pos.playerSd || pos.pcSquares[sqDst].GetSide() == pos.playerSd {
+		return false
+	}
+	delta := sqDst - sqSrc
+	switch pcSrc.GetType() {
+	case PtKing:
+		return sqDst.InFort() && containsSquare(lineMoveDelta[:], delta)
+	case PtAdvisor:
+		return sqDst.InFort() && containsSquare(advisorMoveTab[:], delta)
+	case PtBishop:
+		return sqDst.GetSide() == pos.playerSd && containsSquare(bishopMoveTab[:], delta) &&
+			pos.pcSquares[(sqSrc+sqDst)>>1] == PcNop
+	case PtKnight:
+		sqPin := getKnightPin(sqSrc, sqDst)
+		return sqPin != sqSrc && pos.pcSquares[sqPin] == PcNop
+	case PtRook, PtCannon:
+		var step Square
+		if sqSrc.GetY() == sqDst.GetY() {
+			step = 0x01
+		} else if sqSrc.GetX() == sqDst.GetX() {
+			step = 0x10
+		} else {
+			return false
+		}
+		if delta < 0 {
+			step = -step
+		}
+		nBetween := 0
+		for sq := sqSrc + step; sq != sqDst; sq += step {
+			if pos.pcSquares[sq] != PcNop {
+				nBetween++
+			}
+		}
+		if pcSrc.GetType() == PtRook || pos.pcSquares[sqDst] == PcNop {
+			return nBetween == 0
+		}
+		return nBetween == 1
+	case PtPawn:
+		if sqDst == sqForward(sqSrc, pos.playerSd) {
+			return true
+		}
+		return sqSrc.GetSide() != pos.playerSd && (delta == 0x01 || delta == -0x01)
+	}
+	return false
+}
+
+func containsMove(moves []Move, mv Move) bool {
+	for _, m := range moves {
+		if m == mv {
+			return true
+		}
+	}
+	return false
+}
+
+func containsSquare(squares []Square, sq Square) bool {
+	for _, s := range squares {
+		if s == sq {
+			return true
+		}
+	}
+	return false
 }
+
 func (pos *Position) String() string {
 	var sb strings.Builder
 	for i := 0; i < 10; i++ {
@@ -659,18 +1153,34 @@ func (pos *Position) FenString() string {
 	}
 	sb.WriteRune(' ')
 	if pos.playerSd == SdRed {
-		sb.WriteRune('r')
+		sb.WriteRune('w')
 	} else {
 		sb.WriteRune('b')
 	}
-	sb.WriteString(" - - 0 1")
+	_, _ = fmt.Fprintf(&sb, " - - %d %d", pos.noCapture, pos.fullMove)
 	return sb.String()
 }
 
+// 格子上的棋子
+func (pos *Position) PieceAt(sq Square) Piece {
+	return pos.pcSquares[sq]
+}
+
+// 当前走棋方
+func (pos *Position) PlayerSide() Side {
+	return pos.playerSd
+}
+
+// 当前回合数，从1开始，黑方走完后加一
+func (pos *Position) FullMove() int {
+	return pos.fullMove
+}
+
 // 创建局面
 func CreatePosition() *Position {
 	pos := &Position{}
 	pos.playerSd = SdRed
+	pos.fullMove = 1
 	pos.mvStack = make([]historyMove, 1, limitDepth*2)
 	return pos
 }
@@ -680,6 +1190,14 @@ func CreatePositionFromPosStr(positionStr string) (*Position, error) {
 func CreatePositionFromFenStr(fenStr string) (*Position, error) {
 	return parseFen(fenStr)
 }
+
+// 复制局面，供辅助线程单独使用
+func (pos *Position) clone() *Position {
+	newPos := *pos
+	newPos.mvStack = append(make([]historyMove, 0, cap(pos.mvStack)), pos.mvStack...)
+	return &newPos
+}
+
 func revertSlice(mvs []Move) {
 	for i, j := 0, len(mvs)-1; i < j; i, j = i+1, j-1 {
 		mvs[i], mvs[j] = mvs[j], mvs[i]
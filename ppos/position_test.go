@@ -12,6 +12,7 @@
 package ppos
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
@@ -72,3 +73,208 @@ func TestMatch(t *testing.T) {
 	fmt.Println(pos.FenString())
 
 }
+
+func TestPseudoLegalMove(t *testing.T) {
+	for _, posStr := range []string{
+		"startpos moves h2e2 h9g7 h0g2 i9h9 i0h0 b9c7 h0h4 c6c5 b2c2 b7b3 g3g4 a9b9 b0a2 b3g3",
+		"fen 3PN4/4ak3/4Ra3/9/9/9/9/6n2/3p1p3/4KC1rc w - - 0 1",
+	} {
+		pos, _ := CreatePositionFromPosStr(posStr)
+		for n := 0; n < 2; n++ {
+			generated := make(map[Move]bool)
+			for _, mv := range pos.GenerateMoves(false) {
+				generated[mv] = true
+			}
+			for mv := Move(0); mv < 0xffff; mv++ {
+				if pos.pseudoLegalMove(mv) != generated[mv] {
+					t.Errorf("pseudo legal move mismatch: %v, generated: %v", mv, generated[mv])
+				}
+			}
+			pos.ChangeSide()
+		}
+	}
+}
+
+func TestLegalMove(t *testing.T) {
+	// 红车被将帅对脸牵制
+	pos, _ := CreatePositionFromFenStr("4k4/9/9/9/9/9/9/9/4R4/4K4 w - - 0 1")
+	fen := pos.FenString()
+	if !pos.LegalMove(GetMoveFromICCS("e1e5")) || pos.LegalMove(GetMoveFromICCS("e1d1")) || pos.LegalMove(GetMoveFromICCS("e1e0")) {
+		t.Errorf("wrong legality of pinned rook moves")
+	}
+	if pos.FenString() != fen {
+		t.Errorf("position changed after legal move check: %s", pos.FenString())
+	}
+	// 吃子着法检查后被吃的棋子要放回原处
+	pos, _ = CreatePositionFromPosStr("startpos moves h2e2 h9g7")
+	fen, zobrist := pos.FenString(), pos.zobrist
+	if !pos.LegalMove(GetMoveFromICCS("e2e6")) || !pos.LegalMove(GetMoveFromICCS("b2b9")) {
+		t.Errorf("capture should be legal")
+	}
+	if pos.FenString() != fen || pos.zobrist != zobrist {
+		t.Errorf("position changed after checking a capture: %s", pos.FenString())
+	}
+}
+
+func TestNullMove(t *testing.T) {
+	pos, _ := CreatePositionFromPosStr("startpos moves h2e2 h9g7")
+	zob, sd := pos.zobrist, pos.playerSd
+	pos.MakeNullMove()
+	if pos.playerSd == sd || pos.zobrist == zob {
+		t.Errorf("null move should change side")
+	}
+	pos.UndoNullMove()
+	if pos.playerSd != sd || pos.zobrist != zob || pos.nDistance != 2 {
+		t.Errorf("undo null move failure")
+	}
+	// 空着前后的局面不算重复
+	pos.MakeNullMove()
+	pos.MakeNullMove()
+	if rep, _ := pos.CheckReputation(1); rep {
+		t.Errorf("null moves should not be repetition")
+	}
+	if pos.vlNonPawn[SdRed] != 38 || !pos.nullSafe() {
+		t.Errorf("non pawn value error: %v", pos.vlNonPawn)
+	}
+	endgame, _ := CreatePositionFromFenStr("4k4/9/9/9/9/9/9/9/4A4/3AKN3 w - - 0 1")
+	if endgame.nullOkay() {
+		t.Errorf("null move should be forbidden with only knight and advisors")
+	}
+}
+
+// 固定深度的战术测试集，每题给出局面和最佳着法
+var searchSuite = []struct {
+	fen    string
+	bestMv string
+}{
+	{"3PN4/4ak3/4Ra3/9/9/9/9/6n2/3p1p3/4KC1rc w - - 0 1", "e7f7"},
+	{"4k4/9/9/9/9/9/9/9/R8/R2K5 w - - 0 1", "a1e1"},
+	{"4k4/9/9/9/4r4/9/9/4R4/9/3K5 w - - 0 1", "e2e5"},
+	{"3k5/4a4/4C4/9/9/9/9/9/4R4/5K3 w - - 0 1", "e1d1"},
+	{"3k5/9/9/9/9/9/9/9/9/4K1R2 w - - 0 1", "g0g8"},
+	{"4k4/9/4N4/9/9/9/9/9/4C4/3K5 w - - 0 1", "e1e2"},
+	{"3ak4/4a4/9/9/9/9/9/2C6/9/3K1R3 w - - 0 1", "c2c9"},
+	{"3ak1b2/4a4/4b4/6N2/9/9/9/4C4/9/3K5 w - - 0 1", "g6h8"},
+}
+
+// 按测试集解出的题数验证后期着法减少深度不会漏掉战术
+func TestSearchSuite(t *testing.T) {
+	for _, reductions := range []*ReductionTable{CreateReductionTable(0, 0), nil} {
+		solved := 0
+		for _, test := range searchSuite {
+			pos, _ := CreatePositionFromFenStr(test.fen)
+			mv, _ := pos.Search(context.Background(), SearchParams{Depth: 8, Reductions: reductions})
+			if len(mv) > 0 && mv[0].String() == test.bestMv {
+				solved++
+			} else {
+				t.Logf("%s: expect %s, got %v", test.fen, test.bestMv, mv)
+			}
+		}
+		if solved < len(searchSuite) {
+			t.Errorf("suite score %d/%d", solved, len(searchSuite))
+		}
+	}
+}
+
+func TestReductionTable(t *testing.T) {
+	table := CreateReductionTable(DefaultReductionBase, DefaultReductionDivisor)
+	if table.get(1, 30) != 0 || table.get(lmrMinDepth, 1) != 0 {
+		t.Errorf("shallow or first moves should not be reduced")
+	}
+	for depth := 2; depth <= limitDepth; depth++ {
+		for n := 2; n < lmrMaxMoves; n++ {
+			r := table.get(depth, n)
+			if r < table.get(depth, n-1) || r < table.get(depth-1, n) || r > depth-1 {
+				t.Fatalf("reduction error at depth %d move %d: %d", depth, n, r)
+			}
+		}
+	}
+	if CreateReductionTable(0, 0).get(20, 100) != 0 {
+		t.Errorf("zero divisor should disable reductions")
+	}
+}
+
+func TestSearchThreads(t *testing.T) {
+	for _, test := range searchSuite {
+		pos, _ := CreatePositionFromFenStr(test.fen)
+		mv, _ := pos.Search(context.Background(), SearchParams{Depth: 8, Threads: 4})
+		if len(mv) == 0 || mv[0].String() != test.bestMv {
+			t.Errorf("%s: expect %s, got %v", test.fen, test.bestMv, mv)
+		}
+	}
+	pos, _ := CreatePositionFromPosStr("startpos moves h2e2 h9g7")
+	nodes := 0
+	mv, _ := pos.Search(context.Background(), SearchParams{Depth: 6, Threads: 4, OnIteration: func(info SearchInfo) {
+		nodes = info.Nodes
+	}})
+	if len(mv) == 0 || !pos.LegalMove(mv[0]) || nodes == 0 {
+		t.Errorf("multi-threaded search failure, mv: %v, nodes: %d", mv, nodes)
+	}
+}
+
+// 局面数限制的是所有线程的总数
+func TestSearchThreadsNodeLimit(t *testing.T) {
+	pos, _ := CreatePositionFromPosStr("startpos")
+	const limit = 50000
+	maxNodes := 0
+	pos.Search(context.Background(), SearchParams{Nodes: limit, Threads: 4, OnIteration: func(info SearchInfo) {
+		if info.Nodes > maxNodes {
+			maxNodes = info.Nodes
+		}
+	}})
+	if maxNodes == 0 || maxNodes > limit {
+		t.Errorf("expect at most %d nodes, got %d", limit, maxNodes)
+	}
+}
+
+func TestSearchMultiPV(t *testing.T) {
+	pos, _ := CreatePositionFromPosStr("startpos")
+	var infos []SearchInfo
+	lines := pos.SearchMultiPV(context.Background(), SearchParams{Depth: 5, MultiPV: 3, OnIteration: func(info SearchInfo) {
+		infos = append(infos, info)
+	}})
+	if len(lines) != 3 {
+		t.Fatalf("expect 3 lines, got %v", lines)
+	}
+	firstMoves := map[Move]bool{}
+	for i, line := range lines {
+		if len(line.PV) == 0 || firstMoves[line.PV[0]] {
+			t.Errorf("line %d should start with a different move: %v", i, lines)
+			continue
+		}
+		firstMoves[line.PV[0]] = true
+		if i > 0 && line.Score > lines[i-1].Score {
+			t.Errorf("lines should be sorted by score: %v", lines)
+		}
+	}
+	for _, info := range infos {
+		if info.MultiPV < 1 || info.MultiPV > 3 {
+			t.Errorf("illegal multipv index: %+v", info)
+		}
+	}
+	// 变例数不超过合法着法数
+	pos, _ = CreatePositionFromFenStr("3k5/9/9/9/9/9/9/9/9/4K1R2 w - - 0 1")
+	nLegalMoves := len(pos.legalMoves())
+	lines = pos.SearchMultiPV(context.Background(), SearchParams{Depth: 3, MultiPV: 100})
+	if len(lines) != nLegalMoves || lines[0].PV[0].String() != "g0g8" {
+		t.Errorf("expect %d lines with mate first, got %v", nLegalMoves, lines)
+	}
+}
+
+func TestSearchRootMoves(t *testing.T) {
+	pos, _ := CreatePositionFromFenStr("3k5/9/9/9/9/9/9/9/9/4K1R2 w - - 0 1")
+	mateMv := GetMoveFromICCS("g0g8")
+	mv, _ := pos.Search(context.Background(), SearchParams{Depth: 3, BanMoves: []Move{mateMv}})
+	if len(mv) == 0 || mv[0] == mateMv {
+		t.Errorf("banned move should not be searched: %v", mv)
+	}
+	restricted := GetMoveFromICCS("e0e1")
+	mv, _ = pos.Search(context.Background(), SearchParams{Depth: 3, SearchMoves: []Move{restricted, GetMoveFromICCS("a0a1")}})
+	if len(mv) == 0 || mv[0] != restricted {
+		t.Errorf("only legal search moves should be searched: %v", mv)
+	}
+	mv, vl := pos.Search(context.Background(), SearchParams{Depth: 3, SearchMoves: []Move{mateMv}, BanMoves: []Move{mateMv}})
+	if len(mv) != 0 || vl != -mateValue {
+		t.Errorf("no move should be found: %v, %d", mv, vl)
+	}
+}
@@ -0,0 +1,53 @@
+package ppos
+
+import "math"
+
+// 后期着法减少深度的默认参数，减少的深度 = (base + ln(深度) * ln(着法序号) * 100 / divisor) / 100
+const (
+	DefaultReductionBase    = 75
+	DefaultReductionDivisor = 225
+)
+
+// 深度不小于该值时才减少后期着法的深度
+const lmrMinDepth = 3
+
+// 着法序号的上限，再往后的着法按上限计算
+const lmrMaxMoves = 128
+
+// 后期着法减少的深度表，按剩余深度和着法序号索引
+type ReductionTable [limitDepth + 1][lmrMaxMoves]int8
+
+var defaultReductions = CreateReductionTable(DefaultReductionBase, DefaultReductionDivisor)
+
+// base和divisor均以百分之一为单位，divisor越大减少得越少
+func CreateReductionTable(base, divisor int) *ReductionTable {
+	table := &ReductionTable{}
+	if divisor <= 0 {
+		return table
+	}
+	for depth := 1; depth <= limitDepth; depth++ {
+		for n := 1; n < lmrMaxMoves; n++ {
+			r := (float64(base) + math.Log(float64(depth))*math.Log(float64(n))*10000/float64(divisor)) / 100
+			if r < 0 {
+				r = 0
+			}
+			// 至少留下一层，剩下的交给静态搜索
+			if r > float64(depth-1) {
+				r = float64(depth - 1)
+			}
+			table[depth][n] = int8(r)
+		}
+	}
+	return table
+}
+
+// 第n个着法减少的深度
+func (table *ReductionTable) get(depth, n int) int {
+	if depth > limitDepth {
+		depth = limitDepth
+	}
+	if n >= lmrMaxMoves {
+		n = lmrMaxMoves - 1
+	}
+	return int(table[depth][n])
+}
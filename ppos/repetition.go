@@ -0,0 +1,198 @@
+package ppos
+
+// 亚洲规则下循环着法的性质，数值越大违例越严重
+type RepetitionKind int8
+
+const (
+	// 闲着，允许循环
+	RepIdle RepetitionKind = iota
+	// 长捉
+	RepChase
+	// 长将
+	RepCheck
+)
+
+func (kind RepetitionKind) String() string {
+	switch kind {
+	case RepChase:
+		return "chase"
+	case RepCheck:
+		return "check"
+	default:
+		return "idle"
+	}
+}
+
+// 重复局面的裁决，以当前走棋方为准
+type RepetitionVerdict int8
+
+const (
+	RepDraw RepetitionVerdict = iota
+	RepWin
+	RepLoss
+)
+
+// 重复局面的检测结果
+type Repetition struct {
+	// 当前走棋方在循环中的着法性质
+	Self RepetitionKind
+	// 对方在循环中的着法性质
+	Op      RepetitionKind
+	Verdict RepetitionVerdict
+}
+
+// 违例方判负的评分，比杀棋分低，但仍会被当作胜负已分
+const banValue = mateValue - 50
+
+// 兵(卒)以外的棋子捉子时比较子力的价值，捉有根的子只有价值更大时才算捉
+var chasePieceValue = [7]int{0, 1, 1, 2, 4, 2, 1}
+
+// CheckReputation判和时当前走棋方的评分，与原来的和棋分一致
+const reputationDrawValue = 20
+
+// 检查重复局面
+// return 是否有重复局面， 重复局面的评分（输，赢，和）
+func (pos *Position) CheckReputation(n int) (bool, int) {
+	return pos.checkReputation(n, reputationDrawValue)
+}
+
+// vlDraw 判和时当前走棋方的评分
+func (pos *Position) checkReputation(n int, vlDraw int) (bool, int) {
+	rep, ok := pos.DetectRepetition(n)
+	if !ok {
+		return false, 0
+	}
+	return true, rep.value(vlDraw)
+}
+
+// 当前局面第n次重复时按亚洲规则裁决
+// 一方长将或长捉而另一方闲着时违例方判负，双方都违例时违例较重的一方判负，违例相同或都是闲着判和
+func (pos *Position) DetectRepetition(n int) (Repetition, bool) {
+	start := pos.findRepetition(n)
+	if start == 0 {
+		return Repetition{}, false
+	}
+	kinds := pos.cycleKinds(start)
+	rep := Repetition{Self: kinds[pos.playerSd], Op: kinds[pos.playerSd.OpSide()]}
+	if rep.Self > rep.Op {
+		rep.Verdict = RepLoss
+	} else if rep.Self < rep.Op {
+		rep.Verdict = RepWin
+	}
+	return rep, true
+}
+
+func (rep Repetition) value(vlDraw int) int {
+	switch rep.Verdict {
+	case RepWin:
+		return banValue
+	case RepLoss:
+		return -banValue
+	default:
+		return vlDraw
+	}
+}
+
+// 找到当前局面第n次重复的位置
+// return 循环中第一个着法在mvStack中的下标，没有重复时返回0
+func (pos *Position) findRepetition(n int) int {
+	selfSide := false
+	for mvIdx := pos.nDistance; mvIdx > 0; mvIdx-- {
+		moveHistory := pos.mvStack[mvIdx]
+		// 吃子着法肯定不会重复，空着之前的局面也不算重复
+		if moveHistory.pcCaptured != PcNop || moveHistory.move == MvNop {
+			break
+		}
+		if selfSide && moveHistory.posZobrist == pos.zobrist {
+			n--
+			if n == 0 {
+				return mvIdx
+			}
+		}
+		selfSide = !selfSide
+	}
+	return 0
+}
+
+// 从循环开始的局面重走一遍，判断双方着法的性质
+// 每步都将军为长将；其余着法都捉子，并且始终捉同一个棋子(跟着被捉的子移动)为长捉
+func (pos *Position) cycleKinds(start int) [3]RepetitionKind {
+	p := pos.clone()
+	for p.nDistance >= start {
+		p.UndoMakeMove()
+	}
+	allCheck := [3]bool{true, true, true}
+	// 没有将军的着法中一直被捉的棋子
+	chased := [3][]Square{}
+	for mvIdx := start; mvIdx <= pos.nDistance; mvIdx++ {
+		mv := pos.mvStack[mvIdx].move
+		sd := p.playerSd
+		before := p.chasedSquares(sd)
+		p.MakeMove(mv)
+		for i, sq := range chased[sd.OpSide()] {
+			if sq == mv.Src() {
+				chased[sd.OpSide()][i] = mv.Dst()
+			}
+		}
+		if p.mvStack[p.nDistance].checked {
+			continue
+		}
+		// 走子后新捉的棋子
+		var targets []Square
+		for _, sq := range p.chasedSquares(sd) {
+			if !containsSquare(before, sq) {
+				targets = append(targets, sq)
+			}
+		}
+		if allCheck[sd] {
+			allCheck[sd] = false
+			chased[sd] = targets
+		} else {
+			var remain []Square
+			for _, sq := range chased[sd] {
+				if containsSquare(targets, sq) {
+					remain = append(remain, sq)
+				}
+			}
+			chased[sd] = remain
+		}
+	}
+	var kinds [3]RepetitionKind
+	for _, sd := range []Side{SdRed, SdBlack} {
+		if allCheck[sd] {
+			kinds[sd] = RepCheck
+		} else if len(chased[sd]) > 0 {
+			kinds[sd] = RepChase
+		}
+	}
+	return kinds
+}
+
+// sd方能捉的对方棋子所在的格子
+// 帅(将)和兵(卒)捉子、捉未过河的兵(卒)都不算捉；有根的子只有被价值更小的棋子捉时才算捉
+func (pos *Position) chasedSquares(sd Side) []Square {
+	p := *pos
+	p.playerSd = sd
+	var squares []Square
+	for _, mv := range p.GenerateMoves(true) {
+		sqDst := mv.Dst()
+		attacker, target := p.pcSquares[mv.Src()], p.pcSquares[sqDst]
+		if attacker.GetType() == PtKing || attacker.GetType() == PtPawn || target.GetType() == PtKing {
+			continue
+		}
+		if target.GetType() == PtPawn && sqDst.GetSide() == target.GetSide() {
+			continue
+		}
+		pcCaptured := p.MovePiece(mv)
+		legal := !p.Checked()
+		protected := leastAttacker(&p.pcSquares, sqDst, sd.OpSide()) != 0
+		p.UndoMovePiece(mv, pcCaptured)
+		if !legal || (protected && chasePieceValue[target.GetType()] <= chasePieceValue[attacker.GetType()]) {
+			continue
+		}
+		if !containsSquare(squares, sqDst) {
+			squares = append(squares, sqDst)
+		}
+	}
+	return squares
+}
@@ -0,0 +1,74 @@
+package ppos
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDetectRepetition(t *testing.T) {
+	tests := []struct {
+		name     string
+		position string
+		self, op RepetitionKind
+		verdict  RepetitionVerdict
+	}{
+		// 红车来回将军，黑将来回躲
+		{"perpetual check", "fen 3k5/9/9/9/9/9/9/9/9/4K2R1 w - - 0 1 moves h0h9 d9d8 h9h8 d8d9 h8h9 d9d8 h9h8 d8d9",
+			RepCheck, RepIdle, RepLoss},
+		{"opponent perpetual check", "fen 3k5/9/9/9/9/9/9/9/9/4K2R1 w - - 0 1 moves h0h9 d9d8 h9h8 d8d9 h8h9 d9d8 h9h8",
+			RepIdle, RepCheck, RepWin},
+		// 红车追捉没有根的黑炮
+		{"perpetual chase", "fen 4k4/9/c8/1R7/9/9/9/9/9/3K5 w - - 0 1 moves b6b7 a7a6 b7b6 a6a7 b6b7 a7a6 b7b6 a6a7",
+			RepChase, RepIdle, RepLoss},
+		// 黑炮有车保护，车捉有根的炮不算捉
+		{"protected target", "fen r3k4/9/c8/1R7/9/9/9/9/9/3K5 w - - 0 1 moves b6b7 a7a6 b7b6 a6a7 b6b7 a7a6 b7b6 a6a7",
+			RepIdle, RepIdle, RepDraw},
+		// 马捉有根的车仍然算捉
+		{"chase higher value", "fen 3k5/9/1N7/r8/9/9/9/9/4K4/r8 w - - 0 1 moves b7c5 a6a5 c5b7 a5a6 b7c5 a6a5 c5b7 a5a6",
+			RepChase, RepIdle, RepLoss},
+		// 双方来回走闲着
+		{"idle", "startpos moves h0g2 h9g7 g2h0 g7h9 h0g2 h9g7 g2h0 g7h9", RepIdle, RepIdle, RepDraw},
+	}
+	for _, test := range tests {
+		pos, err := CreatePositionFromPosStr(test.position)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		rep, ok := pos.DetectRepetition(1)
+		if !ok {
+			t.Errorf("%s: repetition not detected", test.name)
+			continue
+		}
+		if rep.Self != test.self || rep.Op != test.op || rep.Verdict != test.verdict {
+			t.Errorf("%s: expect %v %v %v, got %+v", test.name, test.self, test.op, test.verdict, rep)
+		}
+	}
+}
+
+func TestCheckReputationValue(t *testing.T) {
+	pos, _ := CreatePositionFromPosStr("startpos moves h0g2 h9g7 g2h0 g7h9 h0g2 h9g7 g2h0 g7h9")
+	if rep, vl := pos.CheckReputation(1); !rep || vl != reputationDrawValue {
+		t.Errorf("expect draw value %d, got %v %d", reputationDrawValue, rep, vl)
+	}
+	pos, _ = CreatePositionFromPosStr("fen 3k5/9/9/9/9/9/9/9/9/4K2R1 w - - 0 1 moves h0h9 d9d8 h9h8 d8d9 h8h9 d9d8 h9h8 d8d9")
+	if rep, vl := pos.CheckReputation(1); !rep || vl != -banValue {
+		t.Errorf("expect loss value %d, got %v %d", -banValue, rep, vl)
+	}
+}
+
+// 循环中有根节点之前走的着法，搜索时也要判断长将
+func TestSearchRepetitionBeforeRoot(t *testing.T) {
+	pos, _ := CreatePositionFromPosStr("fen 3k5/9/9/9/9/9/9/9/9/4K2R1 w - - 0 1 moves h0h9 d9d8 h9h8 d8d9")
+	fen := pos.FenString()
+	// 红车再将一步就和第一步之后的局面重复，红方长将判负
+	_, vl := pos.Search(context.Background(), SearchParams{Depth: 3, SearchMoves: []Move{GetMoveFromICCS("h8h9")}})
+	if vl > -winValue {
+		t.Errorf("perpetual check should lose, got %d", vl)
+	}
+	if mv, vl := pos.Search(context.Background(), SearchParams{Depth: 3}); len(mv) == 0 || mv[0].String() == "h8h9" || vl < 0 {
+		t.Errorf("perpetual check should be avoided, got %v %d", mv, vl)
+	}
+	if pos.FenString() != fen || pos.nDistance != 4 {
+		t.Errorf("position changed after search: %s", pos.FenString())
+	}
+}
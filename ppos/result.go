@@ -0,0 +1,65 @@
+package ppos
+
+// 自然限着，双方60回合(120个半回合)没有吃子判和
+const naturalMoveLimit = 120
+
+// 重复局面出现该次数时裁决
+const repetitionLimit = 3
+
+// 对局结果
+type GameResult int8
+
+const (
+	ResultUnfinished GameResult = iota
+	ResultRedWin
+	ResultBlackWin
+	ResultDraw
+)
+
+// 棋谱中的结果记法
+func (result GameResult) String() string {
+	switch result {
+	case ResultRedWin:
+		return "1-0"
+	case ResultBlackWin:
+		return "0-1"
+	case ResultDraw:
+		return "1/2-1/2"
+	default:
+		return "*"
+	}
+}
+
+// 按规则裁决当前局面的结果
+// 无着可走(将死或困毙)判负，重复局面按亚洲规则裁决，自然限着和双方都没有进攻子力判和
+func (pos *Position) GameResult() GameResult {
+	if len(pos.legalMoves()) == 0 {
+		return sideWin(pos.playerSd.OpSide())
+	}
+	if rep, ok := pos.DetectRepetition(repetitionLimit); ok {
+		switch rep.Verdict {
+		case RepWin:
+			return sideWin(pos.playerSd)
+		case RepLoss:
+			return sideWin(pos.playerSd.OpSide())
+		default:
+			return ResultDraw
+		}
+	}
+	if pos.drawn() {
+		return ResultDraw
+	}
+	return ResultUnfinished
+}
+
+func sideWin(sd Side) GameResult {
+	if sd == SdRed {
+		return ResultRedWin
+	}
+	return ResultBlackWin
+}
+
+// 是否达到自然限着或双方子力都不足以取胜
+func (pos *Position) drawn() bool {
+	return pos.noCapture >= naturalMoveLimit || pos.nAttackers[SdRed]+pos.nAttackers[SdBlack] == 0
+}
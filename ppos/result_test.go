@@ -0,0 +1,69 @@
+package ppos
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestNoCaptureCounter(t *testing.T) {
+	pos, _ := CreatePositionFromFenStr("rnbakabnr/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C5C1/9/RNBAKABNR w - - 7 12")
+	if !strings.HasSuffix(pos.FenString(), " - - 7 12") {
+		t.Errorf("counters lost: %s", pos.FenString())
+	}
+	pos.MakeMove(GetMoveFromICCS("h2e2"))
+	pos.MakeMove(GetMoveFromICCS("h7e7"))
+	if !strings.HasSuffix(pos.FenString(), " - - 9 13") {
+		t.Errorf("quiet moves should increase counters: %s", pos.FenString())
+	}
+	pos.MakeMove(GetMoveFromICCS("e2e6"))
+	if !strings.HasSuffix(pos.FenString(), " - - 0 13") {
+		t.Errorf("capture should reset counter: %s", pos.FenString())
+	}
+	pos.UndoMakeMove()
+	pos.UndoMakeMove()
+	if !strings.HasSuffix(pos.FenString(), " - - 8 12") {
+		t.Errorf("undo should restore counters: %s", pos.FenString())
+	}
+}
+
+func TestGameResult(t *testing.T) {
+	tests := []struct {
+		position string
+		result   GameResult
+	}{
+		{"startpos moves h2e2 h9g7", ResultUnfinished},
+		// 困毙判负
+		{"fen 3k5/9/9/9/9/9/9/9/9/4K1R2 w - - 0 1 moves g0g8", ResultRedWin},
+		// 长将判负
+		{"fen 3k5/9/9/9/9/9/9/9/9/4K2R1 w - - 0 1 moves h0h9 d9d8 h9h8 d8d9 h8h9 d9d8 h9h8 d8d9 h8h9 d9d8 h9h8 d8d9 h8h9 d9d8 h9h8 d8d9",
+			ResultBlackWin},
+		// 自然限着
+		{"fen 4ka3/4a4/9/9/9/9/9/9/9/R3K4 w - - 119 80", ResultUnfinished},
+		{"fen 4ka3/4a4/9/9/9/9/9/9/9/R3K4 w - - 119 80 moves a0a1", ResultDraw},
+		// 双方都只有士象
+		{"fen 2bak4/4a4/9/9/9/9/9/4B4/4A4/3K5 w - - 0 1", ResultDraw},
+	}
+	for _, test := range tests {
+		pos, err := CreatePositionFromPosStr(test.position)
+		if err != nil {
+			t.Fatalf("%s: %v", test.position, err)
+		}
+		if result := pos.GameResult(); result != test.result {
+			t.Errorf("%s: expect %v, got %v", test.position, test.result, result)
+		}
+	}
+}
+
+func TestSearchNaturalMoveLimit(t *testing.T) {
+	fen := "fen 4ka3/4a4/9/9/9/9/9/9/9/R2K5 w - - %d 80"
+	_, vl := mustPosStr(t, fmt.Sprintf(fen, 0)).Search(context.Background(), SearchParams{Depth: 4})
+	if vl < 100 {
+		t.Errorf("extra rook should be winning: %d", vl)
+	}
+	_, vl = mustPosStr(t, fmt.Sprintf(fen, 119)).Search(context.Background(), SearchParams{Depth: 4})
+	if vl != 0 {
+		t.Errorf("natural move limit should be scored as draw: %d", vl)
+	}
+}
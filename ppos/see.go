@@ -0,0 +1,125 @@
+package ppos
+
+// 静态交换评估用的子力价值，帅(将)只会作为最后一个吃子的棋子
+var seePieceValue = [7]int{5000, 20, 20, 90, 200, 95, 10}
+
+// 静态交换评估，双方轮流用最小的子吃目标格子上的棋子，返回走棋方的得失
+// 每次吃子后重新寻找攻击者，炮架、马腿、象眼的变化都会被考虑，但不考虑牵制和将军
+func (pos *Position) see(mv Move) int {
+	board := pos.pcSquares
+	sqSrc, sqDst := mv.Src(), mv.Dst()
+	var gain [32]int
+	gain[0] = seePieceValue[board[sqDst].GetType()]
+	if board[sqDst] == PcNop {
+		gain[0] = 0
+	}
+	board[sqDst] = board[sqSrc]
+	board[sqSrc] = PcNop
+	sd := board[sqDst].GetSide().OpSide()
+	n := 1
+	for ; n < len(gain); n++ {
+		sqAttacker := leastAttacker(&board, sqDst, sd)
+		if sqAttacker == 0 {
+			break
+		}
+		gain[n] = seePieceValue[board[sqDst].GetType()] - gain[n-1]
+		board[sqDst] = board[sqAttacker]
+		board[sqAttacker] = PcNop
+		sd = sd.OpSide()
+	}
+	// 每一方都可以选择不继续吃子
+	for n--; n > 0; n-- {
+		if -gain[n] < gain[n-1] {
+			gain[n-1] = -gain[n]
+		}
+	}
+	return gain[0]
+}
+
+// 吃子着法是否不亏子，被吃的子不比吃子的子小时不用计算
+func (pos *Position) goodCapture(mv Move) bool {
+	pcSrc, pcDst := pos.pcSquares[mv.Src()], pos.pcSquares[mv.Dst()]
+	if seePieceValue[pcDst.GetType()] >= seePieceValue[pcSrc.GetType()] && pcSrc.GetType() != PtKing {
+		return true
+	}
+	return pos.see(mv) >= 0
+}
+
+// 找出sd方能吃到sq的价值最小的棋子，没有时返回0
+func leastAttacker(board *[256]Piece, sq Square, sd Side) Square {
+	// 1. 兵(卒)，过河后可以横着吃
+	pawn := GetPiece(PtPawn, sd)
+	if sqPawn := sqForward(sq, sd.OpSide()); board[sqPawn] == pawn {
+		return sqPawn
+	}
+	if sq.GetSide() != sd {
+		for delta := Square(-0x01); delta <= 0x01; delta += 0x02 {
+			if board[sq+delta] == pawn {
+				return sq + delta
+			}
+		}
+	}
+	// 2. 仕(士)，只能在九宫内
+	if sq.InFort() {
+		advisor := GetPiece(PtAdvisor, sd)
+		for i := 0; i < 4; i++ {
+			if sqAdvisor := sq + advisorMoveTab[i]; board[sqAdvisor] == advisor {
+				return sqAdvisor
+			}
+		}
+	}
+	// 3. 相(象)，不能过河，象眼不能被塞
+	if sq.GetSide() == sd {
+		bishop := GetPiece(PtBishop, sd)
+		for i := 0; i < 4; i++ {
+			sqBishop := sq + bishopMoveTab[i]
+			if sqBishop.InBoard() && board[sqBishop] == bishop && board[(sq+sqBishop)>>1] == PcNop {
+				return sqBishop
+			}
+		}
+	}
+	// 4. 马，马腿不能被绊
+	knight := GetPiece(PtKnight, sd)
+	for i := 0; i < 8; i++ {
+		sqKnight := sq + knightMoveTab[i]
+		if sqKnight.InBoard() && board[sqKnight] == knight && board[getKnightPin(sqKnight, sq)] == PcNop {
+			return sqKnight
+		}
+	}
+	// 5. 炮和车，炮需要隔一个炮架
+	rook, cannon := GetPiece(PtRook, sd), GetPiece(PtCannon, sd)
+	sqRook, sqCannon := Square(0), Square(0)
+	for i := 0; i < 4; i++ {
+		delta := lineMoveDelta[i]
+		sqDst := sq + delta
+		for ; sqDst.InBoard() && board[sqDst] == PcNop; sqDst += delta {
+		}
+		if !sqDst.InBoard() {
+			continue
+		}
+		if board[sqDst] == rook {
+			sqRook = sqDst
+		}
+		for sqDst += delta; sqDst.InBoard() && board[sqDst] == PcNop; sqDst += delta {
+		}
+		if sqDst.InBoard() && board[sqDst] == cannon {
+			sqCannon = sqDst
+		}
+	}
+	if sqCannon != 0 {
+		return sqCannon
+	}
+	if sqRook != 0 {
+		return sqRook
+	}
+	// 6. 帅(将)，只能在九宫内
+	if sq.InFort() {
+		king := GetPiece(PtKing, sd)
+		for i := 0; i < 4; i++ {
+			if sqKing := sq + lineMoveDelta[i]; board[sqKing] == king {
+				return sqKing
+			}
+		}
+	}
+	return 0
+}
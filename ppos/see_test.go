@@ -0,0 +1,34 @@
+package ppos
+
+import "testing"
+
+func TestSee(t *testing.T) {
+	tests := []struct {
+		fen string
+		mv  string
+		see int
+	}{
+		// 车吃有兵保护的卒
+		{"4k4/9/9/9/4p4/4p4/9/9/4R4/3K5 w - - 0 1", "e1e4", -190},
+		{"4k4/9/9/9/9/4p4/9/9/4R4/3K5 w - - 0 1", "e1e4", 10},
+		// 炮需要炮架才能保护
+		{"3kc4/4a4/4n4/9/9/9/9/9/4R4/5K3 w - - 0 1", "e1e7", -110},
+		{"3kc4/9/4n4/9/9/9/9/9/4R4/5K3 w - - 0 1", "e1e7", 90},
+		// 马腿被绊时不能保护
+		{"5k3/6n2/4c4/9/9/9/9/9/4R4/3K5 w - - 0 1", "e1e7", -105},
+		{"9/5kn2/4c4/9/9/9/9/9/4R4/3K5 w - - 0 1", "e1e7", 95},
+		// 象眼被塞时不能保护
+		{"4k4/9/2b6/9/4n4/9/9/9/4R4/3K5 w - - 0 1", "e1e5", -110},
+		{"4k4/9/2b6/3P5/4n4/9/9/9/4R4/3K5 w - - 0 1", "e1e5", 90},
+		// 车走开后炮没有了炮架，不能接着吃
+		{"4k4/9/9/9/4r4/9/4p4/4R4/4C4/3K5 w - - 0 1", "e2e3", -190},
+		// 隔着炮架的炮可以接着吃
+		{"4k4/9/9/9/4r4/9/4p4/4R4/4A4/3KC4 w - - 0 1", "e2e3", 10},
+	}
+	for _, test := range tests {
+		pos, _ := CreatePositionFromFenStr(test.fen)
+		if see := pos.see(GetMoveFromICCS(test.mv)); see != test.see {
+			t.Errorf("%s %s: expect see %d, got %d", test.fen, test.mv, test.see, see)
+		}
+	}
+}
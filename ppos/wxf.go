@@ -0,0 +1,113 @@
+package ppos
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WXF记法的棋子字母，相(象)为E，马为H
+const wxfPieceLetters = "KAEHRCP"
+
+// WXF记法，如C2.5、H8+7、+R.1
+// 纵线号双方都用阿拉伯数字，同一纵线上两个棋子用+、-表示前后，三个以上的兵(卒)用1-5表示从前往后的序号
+// 多条纵线上都有重叠的兵(卒)时，用纵线号代替棋子字母，如+7.6
+func (pos *Position) MoveToWXF(mv Move) string {
+	rec := pos.moveRecord(mv)
+	var sb strings.Builder
+	if rec.count > 1 {
+		sb.WriteByte(wxfOrder(rec.order, rec.count))
+		if rec.tandemFiles {
+			sb.WriteByte(byte('0' + rec.file))
+		} else {
+			sb.WriteByte(wxfPieceLetters[rec.pt])
+		}
+	} else {
+		sb.WriteByte(wxfPieceLetters[rec.pt])
+		sb.WriteByte(byte('0' + rec.file))
+	}
+	sb.WriteByte(rec.action)
+	sb.WriteByte(byte('0' + rec.num))
+	return sb.String()
+}
+
+func wxfOrder(order, count int) byte {
+	switch {
+	case count > 2:
+		return byte('0' + order)
+	case order == 1:
+		return '+'
+	default:
+		return '-'
+	}
+}
+
+// 解析WXF记法，不区分大小写，相(象)和马也可以写作B和N，前后也可以写在棋子字母后面，如R+.1
+func (pos *Position) ParseWXF(str string) (Move, error) {
+	s := strings.ToUpper(strings.TrimSpace(str))
+	if len(s) != 4 {
+		return MvNop, fmt.Errorf("illegal wxf move: %s", str)
+	}
+	q := recordQuery{pt: -1}
+	if pt, ok := wxfPieceType(s[0]); ok {
+		q.pt = pt
+		if s[1] == '+' || s[1] == '-' {
+			// R+.1
+			q.order = wxfOrderMark(s[1])
+		} else if q.file = wxfDigit(s[1]); q.file == 0 {
+			return MvNop, fmt.Errorf("illegal wxf move: %s", str)
+		}
+	} else {
+		// +R.1、+7.6
+		q.order = wxfOrderMark(s[0])
+		if pt, ok := wxfPieceType(s[1]); ok {
+			q.pt = pt
+		} else {
+			q.file = wxfDigit(s[1])
+		}
+		if q.order == 0 || (q.pt < 0 && q.file == 0) {
+			return MvNop, fmt.Errorf("illegal wxf move: %s", str)
+		}
+	}
+	if s[2] != '+' && s[2] != '-' && s[2] != '.' {
+		return MvNop, fmt.Errorf("illegal wxf move: %s", str)
+	}
+	q.action = s[2]
+	if q.num = wxfDigit(s[3]); q.num == 0 {
+		return MvNop, fmt.Errorf("illegal wxf move: %s", str)
+	}
+	return pos.findRecord(q, str)
+}
+
+func wxfPieceType(c byte) (PieceType, bool) {
+	switch c {
+	case 'B':
+		return PtBishop, true
+	case 'N':
+		return PtKnight, true
+	}
+	if i := strings.IndexByte(wxfPieceLetters, c); i >= 0 {
+		return PieceType(i), true
+	}
+	return 0, false
+}
+
+// 1-9，不是数字时返回0
+func wxfDigit(c byte) int {
+	if c >= '1' && c <= '9' {
+		return int(c - '0')
+	}
+	return 0
+}
+
+func wxfOrderMark(c byte) byte {
+	switch {
+	case c == '+':
+		return 'f'
+	case c == '-':
+		return 'r'
+	case c >= '1' && c <= '5':
+		return c
+	default:
+		return 0
+	}
+}
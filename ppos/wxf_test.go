@@ -0,0 +1,93 @@
+package ppos
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMoveToWXF(t *testing.T) {
+	tests := []struct {
+		position string
+		move     string
+		wxf      string
+	}{
+		{"startpos", "h2e2", "C2.5"},
+		{"startpos", "h0g2", "H2+3"},
+		{"startpos", "c0e2", "E7+5"},
+		{"startpos", "f0e1", "A4+5"},
+		{"startpos", "i0i2", "R1+2"},
+		{"startpos", "g3g4", "P3+1"},
+		{"startpos moves h2e2", "h9g7", "H8+7"},
+		{"startpos moves h2e2", "b7b0", "C2+7"},
+		{"startpos moves h2e2 b9c7 e2e6", "d9e8", "A4+5"},
+		{"fen 4k4/9/9/9/9/9/4R4/9/4R4/4K4 w", "e3e5", "+R+2"},
+		{"fen 4k4/9/9/9/9/9/4R4/9/4R4/4K4 w", "e1i1", "-R.1"},
+		{"fen 3k5/9/2P6/2P3P2/2P3P2/9/9/9/9/4K4 w", "c7c8", "17+1"},
+		{"fen 3k5/9/2P6/2P3P2/2P3P2/9/9/9/9/4K4 w", "g5f5", "-3.4"},
+		{"fen 3k5/9/2P6/2P6/2P6/9/9/9/9/4K4 w", "c6b6", "2P.8"},
+		{"fen 4k4/9/9/9/9/9/9/4p4/4p4/3K5 b", "e1d1", "+P.4"},
+	}
+	for _, test := range tests {
+		pos := mustPosStr(t, test.position)
+		if wxf := pos.MoveToWXF(GetMoveFromICCS(test.move)); wxf != test.wxf {
+			t.Errorf("%s %s: expect %s, got %s", test.position, test.move, test.wxf, wxf)
+		}
+	}
+}
+
+func TestParseWXF(t *testing.T) {
+	tests := []struct {
+		position string
+		wxf      string
+		move     string
+	}{
+		{"startpos", "C2.5", "h2e2"},
+		{"startpos", "c2.5", "h2e2"},
+		{"startpos", "N2+3", "h0g2"},
+		{"startpos", "B3+5", "g0e2"},
+		{"startpos moves h2e2", " h8+7 ", "h9g7"},
+		{"fen 4k4/9/9/9/9/9/4R4/9/4R4/4K4 w", "+R+2", "e3e5"},
+		{"fen 4k4/9/9/9/9/9/4R4/9/4R4/4K4 w", "R-.1", "e1i1"},
+		{"fen 4k4/9/9/9/9/9/4R4/9/4R4/4K4 w", "R5+2", "e3e5"},
+	}
+	for _, test := range tests {
+		pos := mustPosStr(t, test.position)
+		mv, err := pos.ParseWXF(test.wxf)
+		if err != nil {
+			t.Errorf("%s %s: %v", test.position, test.wxf, err)
+		} else if mv.ICCS() != test.move {
+			t.Errorf("%s %s: expect %s, got %s", test.position, test.wxf, test.move, mv.ICCS())
+		}
+	}
+	for _, illegal := range []string{"C2+5", "C2.", "X2.5", "+C.5", "C2.50", "C0.5"} {
+		if mv, err := mustPosStr(t, "startpos").ParseWXF(illegal); err == nil {
+			t.Errorf("%s: expect error, got %s", illegal, mv.ICCS())
+		}
+	}
+}
+
+func TestWXFRoundTrip(t *testing.T) {
+	fens := []string{
+		"3k5/9/2P6/2P3P2/2P3P2/9/9/9/9/4K4 w - - 0 1",
+		"3k5/9/2P6/2P6/2P6/2P6/9/9/9/4K4 w - - 0 1",
+		"2bak4/4a4/4b4/2p1p4/2p1p4/9/9/4C4/4C4/3AK4 b - - 0 1",
+	}
+	for _, test := range perftSuite {
+		fens = append(fens, test.fen)
+	}
+	for _, fen := range fens {
+		pos, err := CreatePositionFromFenStr(fen)
+		if err != nil {
+			t.Fatalf("%s: %v", fen, err)
+		}
+		for _, mv := range pos.legalMoves() {
+			wxf := pos.MoveToWXF(mv)
+			if parsed, err := pos.ParseWXF(wxf); err != nil || parsed != mv {
+				t.Errorf("%s %s %s: got %s, %v", fen, mv.ICCS(), wxf, parsed.ICCS(), err)
+			}
+			if parsed, err := pos.ParseMove(strings.ToLower(wxf), NotationWXF); err != nil || parsed != mv {
+				t.Errorf("%s %s %s: got %s, %v", fen, mv.ICCS(), wxf, parsed.ICCS(), err)
+			}
+		}
+	}
+}
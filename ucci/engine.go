@@ -1,16 +1,53 @@
 package ucci
 
 import (
+	"context"
 	"fmt"
 	"github.com/fuyuntt/cchess/ppos"
+	"github.com/fuyuntt/cchess/util"
 	"github.com/sirupsen/logrus"
 	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 type Engine struct {
 	pos *ppos.Position
+	// banmoves指令禁止的着法，在下一条position指令前一直有效
+	banMoves []ppos.Move
+	// 引擎选项
+	options *optionRegistry
+	// 置换表，在多次搜索之间保留
+	hashTable *ppos.HashTable
+	// 后期着法减少深度表，由ReductionBase和ReductionDivisor选项决定
+	reductions *ppos.ReductionTable
+	// 通过LogFile选项打开的日志文件
+	logFile *os.File
+	// 正在后台进行的搜索
+	task *searchTask
+	// 通过BookFile选项加载的开局库，为空时不使用开局库
+	book *ppos.Book
+	// 从开局库中随机选择着法
+	rnd *rand.Rand
+}
+
+// 后台搜索任务
+type searchTask struct {
+	params *goParams
+	cancel context.CancelFunc
+	// 搜索结束并输出bestmove后关闭
+	done chan struct{}
+	// 后台思考命中时关闭
+	ponderHit chan struct{}
+	// 后台思考命中后的计时器
+	timer *time.Timer
+	// 开始搜索的时间，后台思考命中时已经用掉的时间要从本步的时间中扣除
+	start time.Time
 }
 
 func (engine *Engine) ExecCommand(ctx *CmdCtx, cmdStr string) {
@@ -21,24 +58,132 @@ func (engine *Engine) ExecCommand(ctx *CmdCtx, cmdStr string) {
 		engine.ucci(ctx)
 	case "isready":
 		engine.isReady(ctx)
+	case "setoption":
+		if len(cmdParam) > 1 {
+			engine.setOption(ctx, cmdParam[1])
+		}
 	case "position":
 		engine.position(cmdParam[1])
+	case "banmoves":
+		var paramStr string
+		if len(cmdParam) > 1 {
+			paramStr = cmdParam[1]
+		}
+		engine.banMoves = parseMoves(strings.Fields(paramStr))
 	case "go":
-		engine.goThink(ctx)
+		var paramStr string
+		if len(cmdParam) > 1 {
+			paramStr = cmdParam[1]
+		}
+		engine.goThink(ctx, parseGoParams(paramStr))
+	case "ponderhit":
+		engine.ponderHit()
+	case "stop":
+		engine.stop()
 	case "quit":
 		engine.quit(ctx)
 	}
 }
 func CreateEngine() *Engine {
-	return &Engine{}
+	engine := &Engine{options: createOptionRegistry(), rnd: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	engine.registerOptions()
+	engine.hashTable = ppos.CreateHashTable(engine.options.get("Hash").intValue())
+	engine.reductions = ppos.CreateReductionTable(ppos.DefaultReductionBase, ppos.DefaultReductionDivisor)
+	// 日志文件只通过LogFile选项打开，这样修改选项时能关闭原来的文件
+	if err := engine.openLogFile(engine.options.get("LogFile")); err != nil {
+		logrus.Errorf("open log file failure. err=%v", err)
+	}
+	return engine
+}
+
+// 最高棋力等级，低于该等级时限制搜索深度
+const maxSkillLevel = 20
+
+func (engine *Engine) registerOptions() {
+	engine.options.register(&option{name: "usemillisec", typ: optCheck, def: "false"})
+	// 后台搜索会同时读写置换表，更换或清空置换表前要先停止搜索
+	engine.options.register(&option{name: "Hash", typ: optSpin, def: strconv.Itoa(ppos.DefaultHashSizeMB), min: 1, max: 1024,
+		onChange: func(engine *Engine, opt *option) error {
+			engine.stop()
+			engine.hashTable = ppos.CreateHashTable(opt.intValue())
+			return nil
+		}})
+	engine.options.register(&option{name: "ClearHash", typ: optButton,
+		onChange: func(engine *Engine, opt *option) error {
+			engine.stop()
+			engine.hashTable.Clear()
+			return nil
+		}})
+	engine.options.register(&option{name: "Threads", typ: optSpin, def: "1", min: 1, max: 64})
+	engine.options.register(&option{name: "MultiPV", typ: optSpin, def: "1", min: 1, max: ppos.MaxMultiPV})
+	engine.options.register(&option{name: "BookFile", typ: optString, onChange: (*Engine).openBook})
+	engine.options.register(&option{name: "SkillLevel", typ: optSpin, def: strconv.Itoa(maxSkillLevel), min: 0, max: maxSkillLevel})
+	engine.options.register(&option{name: "Contempt", typ: optSpin, def: strconv.Itoa(ppos.DefaultContempt), min: -100, max: 100})
+	engine.options.register(&option{name: "ReductionBase", typ: optSpin, def: strconv.Itoa(ppos.DefaultReductionBase), min: 0, max: 300,
+		onChange: (*Engine).updateReductions})
+	engine.options.register(&option{name: "ReductionDivisor", typ: optSpin, def: strconv.Itoa(ppos.DefaultReductionDivisor), min: 0, max: 1000,
+		onChange: (*Engine).updateReductions})
+	engine.options.register(&option{name: "LogFile", typ: optString, def: util.DefaultLogFile, onChange: (*Engine).openLogFile})
+	engine.options.register(&option{name: "LogLevel", typ: optCombo, def: "info", vars: []string{"debug", "info", "warn", "error"},
+		onChange: func(engine *Engine, opt *option) error {
+			level, err := logrus.ParseLevel(opt.value)
+			if err == nil {
+				logrus.SetLevel(level)
+			}
+			return err
+		}})
+}
+
+// 重新生成后期着法减少深度表，ReductionDivisor为0时不减少深度
+func (engine *Engine) updateReductions(opt *option) error {
+	engine.reductions = ppos.CreateReductionTable(engine.options.get("ReductionBase").intValue(),
+		engine.options.get("ReductionDivisor").intValue())
+	return nil
+}
+
+// 日志输出到指定文件，为空时不输出日志
+func (engine *Engine) openLogFile(opt *option) error {
+	var file *os.File
+	if opt.value == "" {
+		logrus.SetOutput(ioutil.Discard)
+	} else {
+		var err error
+		if file, err = util.OpenLogFile(opt.value); err != nil {
+			return err
+		}
+		logrus.SetOutput(file)
+	}
+	if engine.logFile != nil {
+		_ = engine.logFile.Close()
+	}
+	engine.logFile = file
+	return nil
 }
+
+// 加载开局库，为空时不使用开局库
+func (engine *Engine) openBook(opt *option) error {
+	if opt.value == "" {
+		engine.book = nil
+		return nil
+	}
+	book, err := ppos.OpenBook(opt.value)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("book loaded, %d entries", book.Len())
+	engine.book = book
+	return nil
+}
+
 func (engine *Engine) ucci(ctx *CmdCtx) {
 	ctx.fPrintln("id name FunChess 1.0")
 	ctx.fPrintln("id copyright 2004-2006 www.fuyuntt.com")
 	ctx.fPrintln("id author Fu Yun")
 	ctx.fPrintln("id user 2004-2006 www.fuyuntt.com")
 
-	ctx.fPrintln("option usemillisec type check")
+	for _, opt := range engine.options.options {
+		ctx.fPrintln(opt.String())
+	}
 	ctx.fPrintln("ucciok")
 }
 
@@ -46,36 +191,320 @@ func (engine *Engine) isReady(ctx *CmdCtx) {
 	ctx.fPrintln("readyok")
 }
 
+func (engine *Engine) setOption(ctx *CmdCtx, optionStr string) {
+	name, value := parseSetOption(optionStr)
+	opt := engine.options.get(name)
+	if opt == nil {
+		logrus.Warnf("unsupported option: %s", optionStr)
+		return
+	}
+	oldValue := opt.value
+	err := opt.set(value)
+	if err == nil && opt.onChange != nil {
+		err = opt.onChange(engine, opt)
+	}
+	if err != nil {
+		opt.value = oldValue
+		logrus.Errorf("set option failure. %s, err=%v", optionStr, err)
+		return
+	}
+	logrus.Infof("option %s set to %s", opt.name, opt.value)
+}
+
 func (engine *Engine) position(positionStr string) {
 	position, err := ppos.CreatePositionFromPosStr(positionStr)
 	if err != nil {
 		logrus.Errorf("parse position failure, position: %s, err: %v", positionStr, err)
 	}
 	engine.pos = position
+	engine.banMoves = nil
+}
+
+// go指令的参数
+type goParams struct {
+	ponder   bool
+	draw     bool
+	infinite bool
+	depth    int
+	nodes    int
+	// 时间相关参数的单位取决于usemillisec选项
+	time         int
+	movesToGo    int
+	increment    int
+	oppTime      int
+	oppMovesToGo int
+	oppIncrement int
+	// 只搜索这些着法
+	searchMoves []ppos.Move
+}
+
+// 解析go指令
+// go [ponder | draw] [searchmoves <m1> <m2> ...] [depth <d> | nodes <n> | time <t> [movestogo <m> | increment <i>] [opptime <t> [oppmovestogo <m> | oppincrement <i>]] | infinite]
+func parseGoParams(paramStr string) *goParams {
+	params := &goParams{}
+	fields := strings.Fields(paramStr)
+	intParams := map[string]*int{
+		"nodes":        &params.nodes,
+		"time":         &params.time,
+		"movestogo":    &params.movesToGo,
+		"increment":    &params.increment,
+		"opptime":      &params.oppTime,
+		"oppmovestogo": &params.oppMovesToGo,
+		"oppincrement": &params.oppIncrement,
+	}
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "ponder":
+			params.ponder = true
+		case "draw":
+			params.draw = true
+		case "infinite":
+			params.infinite = true
+		case "searchmoves":
+			// 后面连续的ICCS格式着法都是要搜索的着法
+			j := i + 1
+			for j < len(fields) && isICCS(fields[j]) {
+				j++
+			}
+			params.searchMoves = parseMoves(fields[i+1 : j])
+			i = j - 1
+		case "depth":
+			if i+1 < len(fields) {
+				i++
+				if fields[i] == "infinite" {
+					params.infinite = true
+				} else {
+					params.depth = parseIntParam(fields[i])
+				}
+			}
+		default:
+			if p, ok := intParams[fields[i]]; ok && i+1 < len(fields) {
+				i++
+				*p = parseIntParam(fields[i])
+			}
+		}
+	}
+	return params
+}
+
+// 解析ICCS格式的着法列表，忽略格式错误的着法
+func parseMoves(fields []string) []ppos.Move {
+	var moves []ppos.Move
+	for _, field := range fields {
+		if !isICCS(field) {
+			logrus.Errorf("illegal move: %s", field)
+			continue
+		}
+		moves = append(moves, ppos.GetMoveFromICCS(field))
+	}
+	return moves
+}
+
+// 是否ICCS格式的着法，如h2e2
+func isICCS(str string) bool {
+	return len(str) == 4 && str[0] >= 'a' && str[0] <= 'i' && str[1] >= '0' && str[1] <= '9' &&
+		str[2] >= 'a' && str[2] <= 'i' && str[3] >= '0' && str[3] <= '9'
+}
+
+func parseIntParam(str string) int {
+	v, err := strconv.Atoi(str)
+	if err != nil {
+		logrus.Errorf("illegal go param: %s", str)
+	}
+	return v
+}
+
+func (engine *Engine) searchParams(params *goParams) ppos.SearchParams {
+	searchParams := ppos.SearchParams{Contempt: engine.options.get("Contempt").intValue(), HashTable: engine.hashTable,
+		Reductions: engine.reductions, Threads: engine.options.get("Threads").intValue(),
+		MultiPV: engine.options.get("MultiPV").intValue(), BanMoves: engine.banMoves, SearchMoves: params.searchMoves}
+	switch {
+	case params.infinite || params.ponder:
+		// 后台思考时不限时间，直到ponderhit才开始计时
+	case params.depth > 0 || params.nodes > 0:
+		searchParams.Depth = params.depth
+		searchParams.Nodes = params.nodes
+	default:
+		searchParams.Duration = allocateTime(params, engine.timeUnit())
+	}
+	// 降低棋力时限制搜索深度，后台思考也一样
+	if skill := engine.options.get("SkillLevel").intValue(); skill < maxSkillLevel {
+		skillDepth := skill/2 + 1
+		if searchParams.Depth == 0 || searchParams.Depth > skillDepth {
+			searchParams.Depth = skillDepth
+		}
+	}
+	return searchParams
 }
 
-func (engine *Engine) goThink(ctx *CmdCtx) {
-	moves, vl := engine.pos.SearchMain(3 * time.Second)
-	logrus.Infof("moves: %v, vl %d", moves, vl)
-	ctx.fPrintln("bestmove " + moves[0].String())
+// 时间参数的单位
+func (engine *Engine) timeUnit() time.Duration {
+	if engine.options.get("usemillisec").boolValue() {
+		return time.Millisecond
+	}
+	return time.Second
+}
+
+// 在后台开始搜索，搜索结束后输出bestmove
+func (engine *Engine) goThink(ctx *CmdCtx, params *goParams) {
+	engine.stop()
+	// position指令解析失败时没有局面可以搜索
+	if engine.pos == nil {
+		logrus.Errorf("no position to search")
+		ctx.fPrintln("nobestmove")
+		return
+	}
+	if mv, ok := engine.probeBook(params); ok {
+		logrus.Infof("book move: %v", mv)
+		ctx.fPrintln("bestmove " + mv.String())
+		return
+	}
+	searchParams := engine.searchParams(params)
+	logrus.Infof("search params: %+v", searchParams)
+	searchParams.OnIteration = func(info ppos.SearchInfo) {
+		ctx.printSearchInfo(info)
+	}
+	searchParams.OnCurrMove = func(mv ppos.Move, number int) {
+		ctx.fPrintln(fmt.Sprintf("info currmove %v currmovenumber %d", mv, number))
+	}
+	c, cancel := context.WithCancel(context.Background())
+	task := &searchTask{params: params, cancel: cancel, done: make(chan struct{}), ponderHit: make(chan struct{}), start: time.Now()}
+	engine.task = task
+	pos := engine.pos
+	go func() {
+		defer close(task.done)
+		moves, vl := pos.Search(c, searchParams)
+		logrus.Infof("moves: %v, vl %d", moves, vl)
+		// 无限思考模式下，需要等到stop指令才能输出结果；后台思考还可以等到ponderhit
+		if params.infinite {
+			<-c.Done()
+		} else if params.ponder {
+			select {
+			case <-c.Done():
+			case <-task.ponderHit:
+			}
+		}
+		if len(moves) == 0 {
+			ctx.fPrintln("nobestmove")
+			return
+		}
+		if len(moves) > 1 {
+			ctx.fPrintln("bestmove " + moves[0].String() + " ponder " + moves[1].String())
+		} else {
+			ctx.fPrintln("bestmove " + moves[0].String())
+		}
+	}()
+}
+
+// 从开局库中选择着法，无限思考和后台思考时不使用开局库
+func (engine *Engine) probeBook(params *goParams) (ppos.Move, bool) {
+	if engine.book == nil || engine.pos == nil || params.infinite || params.ponder {
+		return ppos.MvNop, false
+	}
+	return engine.book.Probe(engine.pos, engine.rnd, func(mv ppos.Move) bool {
+		for _, ban := range engine.banMoves {
+			if mv == ban {
+				return false
+			}
+		}
+		if len(params.searchMoves) == 0 {
+			return true
+		}
+		for _, searchMove := range params.searchMoves {
+			if mv == searchMove {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// 对手走了猜测的着法，后台思考转为正常计时思考，保留已有的搜索结果
+func (engine *Engine) ponderHit() {
+	task := engine.task
+	if task == nil || !task.params.ponder {
+		return
+	}
+	select {
+	case <-task.ponderHit:
+		return
+	default:
+	}
+	close(task.ponderHit)
+	if task.params.infinite {
+		return
+	}
+	// 后台思考的搜索结果已经保留下来，分配给本步的时间扣除已经思考的时间
+	budget := allocateTime(task.params, engine.timeUnit()) - time.Since(task.start)
+	if budget < minThinkTime {
+		budget = minThinkTime
+	}
+	logrus.Infof("ponder hit, think time: %v", budget)
+	task.timer = time.AfterFunc(budget, task.cancel)
+}
+
+// 停止后台搜索，并等待bestmove输出
+func (engine *Engine) stop() {
+	if engine.task == nil {
+		return
+	}
+	engine.task.cancel()
+	if engine.task.timer != nil {
+		engine.task.timer.Stop()
+	}
+	<-engine.task.done
+	engine.task = nil
 }
 
 func (engine *Engine) quit(ctx *CmdCtx) {
+	engine.stop()
 	ctx.fPrintln("bye")
 }
 
+// 指令输出，后台搜索和指令处理会同时输出，需加锁
 type CmdCtx struct {
+	lock   sync.Mutex
 	output io.Writer
 }
 
 func CreateCmdCtx(writer io.Writer) *CmdCtx {
-	return &CmdCtx{writer}
+	return &CmdCtx{output: writer}
 }
 
 func (ctx *CmdCtx) fPrintln(a ...interface{}) {
 	logrus.Infof("ucci: %v", a)
+	ctx.lock.Lock()
+	defer ctx.lock.Unlock()
 	_, err := fmt.Fprintln(ctx.output, a...)
 	if err != nil {
 		logrus.Errorf("output write failure. %v, err=%v", a, err)
 	}
 }
+
+// 输出一层迭代的搜索信息
+func (ctx *CmdCtx) printSearchInfo(info ppos.SearchInfo) {
+	var sb strings.Builder
+	ms := info.Time.Milliseconds()
+	_, _ = fmt.Fprintf(&sb, "info depth %d", info.Depth)
+	if info.MultiPV > 0 {
+		_, _ = fmt.Fprintf(&sb, " multipv %d", info.MultiPV)
+	}
+	_, _ = fmt.Fprintf(&sb, " score %d", info.Score)
+	switch info.Bound {
+	case ppos.BoundLower:
+		sb.WriteString(" lowerbound")
+	case ppos.BoundUpper:
+		sb.WriteString(" upperbound")
+	}
+	_, _ = fmt.Fprintf(&sb, " time %d nodes %d", ms, info.Nodes)
+	if ms > 0 {
+		_, _ = fmt.Fprintf(&sb, " nps %d", int64(info.Nodes)*1000/ms)
+	}
+	if len(info.PV) > 0 {
+		sb.WriteString(" pv")
+		for _, mv := range info.PV {
+			sb.WriteString(" " + mv.String())
+		}
+	}
+	ctx.fPrintln(sb.String())
+}
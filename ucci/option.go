@@ -0,0 +1,143 @@
+package ucci
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type optionType string
+
+const (
+	optCheck  optionType = "check"
+	optSpin   optionType = "spin"
+	optCombo  optionType = "combo"
+	optString optionType = "string"
+	optButton optionType = "button"
+)
+
+// 引擎选项
+type option struct {
+	name string
+	typ  optionType
+	// 默认值
+	def string
+	// spin类型的取值范围
+	min int
+	max int
+	// combo类型的可选值
+	vars []string
+	// 当前值
+	value string
+	// 选项设置后的回调，返回错误时恢复原值
+	onChange func(engine *Engine, opt *option) error
+}
+
+// ucci指令中的选项描述
+// option <选项> type <类型> [min <最小值>] [max <最大值>] [var <可选项> [var <可选项> [...]]] [default <默认值>]
+func (opt *option) String() string {
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "option %s type %s", opt.name, opt.typ)
+	if opt.typ == optSpin {
+		_, _ = fmt.Fprintf(&sb, " min %d max %d", opt.min, opt.max)
+	}
+	for _, v := range opt.vars {
+		sb.WriteString(" var " + v)
+	}
+	if opt.typ != optButton {
+		// 空字符串在ucci中用<empty>表示
+		def := opt.def
+		if def == "" {
+			def = "<empty>"
+		}
+		sb.WriteString(" default " + def)
+	}
+	return sb.String()
+}
+
+func (opt *option) set(value string) error {
+	switch opt.typ {
+	case optCheck:
+		// 只写选项名时视为打开
+		if value == "" {
+			value = "true"
+		}
+		if value != "true" && value != "false" {
+			return fmt.Errorf("option %s expects true or false, got %s", opt.name, value)
+		}
+	case optSpin:
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("option %s expects an integer, got %s", opt.name, value)
+		}
+		if v < opt.min || v > opt.max {
+			return fmt.Errorf("option %s out of range [%d, %d]: %d", opt.name, opt.min, opt.max, v)
+		}
+	case optCombo:
+		found := false
+		for _, v := range opt.vars {
+			if strings.EqualFold(v, value) {
+				value = v
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("option %s does not accept %s", opt.name, value)
+		}
+	case optString:
+		if value == "<empty>" {
+			value = ""
+		}
+	}
+	opt.value = value
+	return nil
+}
+
+func (opt *option) boolValue() bool {
+	return opt.value == "true"
+}
+
+func (opt *option) intValue() int {
+	v, _ := strconv.Atoi(opt.value)
+	return v
+}
+
+// 选项表，按注册顺序输出
+type optionRegistry struct {
+	options []*option
+	byName  map[string]*option
+}
+
+func createOptionRegistry() *optionRegistry {
+	return &optionRegistry{byName: make(map[string]*option)}
+}
+
+func (reg *optionRegistry) register(opt *option) {
+	opt.value = opt.def
+	reg.options = append(reg.options, opt)
+	reg.byName[strings.ToLower(opt.name)] = opt
+}
+
+// 选项名不区分大小写
+func (reg *optionRegistry) get(name string) *option {
+	return reg.byName[strings.ToLower(name)]
+}
+
+// 解析setoption指令，兼容以下两种写法
+// setoption <选项> [<值>]
+// setoption name <选项> [value <值>]
+func parseSetOption(optionStr string) (string, string) {
+	optionStr = strings.TrimSpace(optionStr)
+	if strings.HasPrefix(optionStr, "name ") {
+		optionStr = strings.TrimSpace(optionStr[len("name "):])
+		if idx := strings.Index(optionStr, " value "); idx >= 0 {
+			return optionStr[:idx], strings.TrimSpace(optionStr[idx+len(" value "):])
+		}
+		return optionStr, ""
+	}
+	nameValue := strings.SplitN(optionStr, " ", 2)
+	if len(nameValue) < 2 {
+		return nameValue[0], ""
+	}
+	return nameValue[0], strings.TrimSpace(nameValue[1])
+}
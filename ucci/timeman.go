@@ -0,0 +1,51 @@
+package ucci
+
+import "time"
+
+// 未指定时间时的默认思考时间
+const defaultThinkTime = 3 * time.Second
+
+// 未指定剩余步数时，假定还要走的步数
+const defaultMovesToGo = 30
+
+// 为网络延迟等保留的时间
+const timeReserve = 100 * time.Millisecond
+
+// 每步最少的思考时间
+const minThinkTime = 10 * time.Millisecond
+
+// 根据剩余时间分配本步的思考时间
+func allocateTime(params *goParams, unit time.Duration) time.Duration {
+	if params.time <= 0 {
+		return defaultThinkTime
+	}
+	remain := time.Duration(params.time) * unit
+	increment := time.Duration(params.increment) * unit
+	var budget time.Duration
+	if params.movesToGo > 0 {
+		// 时段制，剩余时间平均分配到剩余步数上
+		budget = remain / time.Duration(params.movesToGo)
+	} else {
+		// 加时制，每步可以多用掉大部分的加秒
+		budget = remain/defaultMovesToGo + increment*3/4
+	}
+	// 比对手剩余时间多时可以适当多想一些
+	if params.oppTime > 0 {
+		oppRemain := time.Duration(params.oppTime) * unit
+		if remain > oppRemain {
+			budget += (remain - oppRemain) / defaultMovesToGo
+		}
+	}
+	// 无论如何不能超时
+	maxBudget := remain - timeReserve
+	if params.movesToGo != 1 {
+		maxBudget = remain / 2
+	}
+	if budget > maxBudget {
+		budget = maxBudget
+	}
+	if budget < minThinkTime {
+		budget = minThinkTime
+	}
+	return budget
+}
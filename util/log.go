@@ -0,0 +1,11 @@
+package util
+
+import "os"
+
+// 默认的日志文件
+const DefaultLogFile = "chess.log"
+
+// 打开日志文件，已有的内容会被清空，日志只保留本次运行的记录
+func OpenLogFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+}